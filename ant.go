@@ -2,84 +2,28 @@ package main
 
 import (
 	"database/sql"
+	"flag"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
-	_ "github.com/mattn/go-sqlite3"
+	"github.com/gagehenrich/ant/api"
+	"github.com/gagehenrich/ant/logs"
+	"github.com/gagehenrich/ant/runner"
+	"github.com/gagehenrich/ant/schedule"
+	"github.com/gagehenrich/ant/store"
 )
 
-const dbPath = "./ant.db3"
-
-// ScheduleType represents the type of schedule
-type ScheduleType int
-
-const (
-	SingleRun ScheduleType = iota
-	Repeating
-)
-
-// Schedule represents a parsed schedule
-type Schedule struct {
-	Type       ScheduleType
-	Interval   time.Duration // for interval-based schedules (15m, 1h, etc)
-	Weekday    time.Weekday  // for weekday-based schedules
-	TimeOfDay  time.Time     // for specific time schedules
-	IsInterval bool          // true if this is an interval-based schedule
-}
-
-// Job represents a scheduled job with Unix timestamps
-type Job struct {
-	ID       int
-	Schedule string
-	Command  string
-	PID      int
-	NextRun  int64 // Unix timestamp
-	LastRun  int64 // Unix timestamp
-}
-
-// Initialize the database and create the jobs table if it doesn't exist
-func initDB() (*sql.DB, error) {
-	db, err := sql.Open("sqlite3", dbPath)
-	if err != nil {
-		return nil, err
-	}
-
-	// Only create table if it doesn't exist
-	createTable := `
-	CREATE TABLE IF NOT EXISTS jobs (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		schedule TEXT,
-		command TEXT,
-		pid INTEGER,
-		next_run INTEGER, -- Unix timestamp
-		last_run INTEGER  -- Unix timestamp
-	);`
-	_, err = db.Exec(createTable)
-	if err != nil {
-		return nil, err
-	}
-	return db, nil
-}
-
-
-// AddJob inserts a new job into the database and returns its ID
-func AddJob(db *sql.DB, schedule, command string, nextRun time.Time) (int64, error) {
-	result, err := db.Exec(
-		"INSERT INTO jobs (schedule, command, next_run, last_run, pid) VALUES (?, ?, ?, ?, ?)",
-		schedule,
-		command,
-		nextRun.Unix(),
-		0, // Initial last_run is 0
-		0, // Initial PID is 0
-	)
-	if err != nil {
-		return 0, err
-	}
-	return result.LastInsertId()
+// Initialize the database, applying any pending schema migrations
+func initDB(dbPath string) (*sql.DB, error) {
+	return store.Open(dbPath)
 }
 
 // UpdateJobRuns updates both the next_run and last_run times for a job
@@ -93,35 +37,135 @@ func UpdateJobRuns(db *sql.DB, jobID int, nextRun, lastRun time.Time) error {
 	return err
 }
 
-// ListJobs displays all jobs stored in the database
-func ListJobs(db *sql.DB) error {
-	rows, err := db.Query("SELECT id, schedule, command, pid, next_run, last_run FROM jobs")
-	if err != nil {
-		return err
-	}
-	defer rows.Close()
-
-	fmt.Println("ID | Schedule | Command | PID | Next Run | Last Run")
-	fmt.Println("----------------------------------------------------")
-	for rows.Next() {
-		var job Job
-		err := rows.Scan(&job.ID, &job.Schedule, &job.Command, &job.PID, &job.NextRun, &job.LastRun)
-		if err != nil {
-			return err
-		}
+// ListJobs displays all jobs
+func ListJobs(jobs []store.JobStatus) {
+	fmt.Println("ID | Schedule | Command | PID | Next Run | Last Run | Status | Exit | Fails")
+	fmt.Println("---------------------------------------------------------------------------")
+	for _, job := range jobs {
 		
-		nextRunTime := time.Unix(job.NextRun, 0).Format("2006-01-02 15:04:05")
+		nextRunTime := "Not scheduled"
+		if job.NextRun > 0 {
+			nextRunTime = time.Unix(job.NextRun, 0).Format("2006-01-02 15:04:05")
+		}
+		if job.RetryAt > 0 && (job.NextRun == 0 || job.RetryAt < job.NextRun) {
+			nextRunTime = fmt.Sprintf("%s (attempt %d)",
+				time.Unix(job.RetryAt, 0).Format("2006-01-02 15:04:05"), job.RetryAttempt)
+		}
 		lastRunTime := "Never"
 		if job.LastRun > 0 {
 			lastRunTime = time.Unix(job.LastRun, 0).Format("2006-01-02 15:04:05")
 		}
 		
-		fmt.Printf("%d | %s | %s | %d | %s | %s\n",
-			job.ID, job.Schedule, job.Command, job.PID, nextRunTime, lastRunTime)
+		status := job.LastStatus
+		if job.Queued && job.PID == 0 {
+			status = "queued"
+		}
+		if job.Paused && job.PID == 0 {
+			status = "paused"
+		}
+		if status == "" {
+			status = "-"
+		}
+		exitCode := "-"
+		if job.LastExitCode != nil && job.LastStatus != "running" {
+			exitCode = strconv.Itoa(*job.LastExitCode)
+		}
+
+		fmt.Printf("%d | %s | %s | %d | %s | %s | %s | %s | %d\n",
+			job.ID, job.Schedule, job.Command, job.PID, nextRunTime, lastRunTime,
+			status, exitCode, job.FailCount)
+	}
+}
+
+// listJobs reads every job from antd if it is running, and otherwise
+// from the database
+func listJobs(client *api.Client, db *sql.DB) ([]store.JobStatus, error) {
+	if client != nil {
+		return client.Jobs()
+	}
+	return store.ListJobs(db)
+}
+
+// ShowHistory displays the most recent runs of a job, newest first
+func ShowHistory(runs []store.RunRecord, jobID int) {
+	if len(runs) == 0 {
+		fmt.Printf("No runs recorded for job %d.\n", jobID)
+		return
+	}
+
+	fmt.Println("Run | Scheduled | Attempt | Started | Duration | CPU | Memory | Status | Exit | PID | Host")
+	fmt.Println("-------------------------------------------------------------------------------------------")
+	for _, run := range runs {
+		formatTime := func(t int64) string {
+			if t == 0 {
+				return "-"
+			}
+			return time.Unix(t, 0).Format("2006-01-02 15:04:05")
+		}
+
+		duration := "-"
+		if run.DurationMs != nil {
+			duration = (time.Duration(*run.DurationMs) * time.Millisecond).String()
+		}
+
+		// Usage is only measured when antd runs jobs in cgroups
+		cpu, memory := "-", "-"
+		if run.CPUUsec != nil {
+			cpu = (time.Duration(*run.CPUUsec) * time.Microsecond).Round(time.Millisecond).String()
+		}
+		if run.PeakMemory != nil {
+			memory = runner.FormatBytes(*run.PeakMemory)
+		}
+
+		exit := "-"
+		if run.Signal > 0 {
+			exit = syscall.Signal(run.Signal).String()
+		} else if run.ExitCode != nil {
+			exit = strconv.Itoa(*run.ExitCode)
+		}
+
+		pid := "-"
+		if run.PID > 0 {
+			pid = strconv.Itoa(run.PID)
+		}
+
+		line := fmt.Sprintf("%d | %s | %d | %s | %s | %s | %s | %s | %s | %s | %s",
+			run.ID, formatTime(run.Scheduled), run.Attempt, formatTime(run.Started), duration, cpu, memory,
+			run.Status, exit, pid, run.Host)
+		if run.Note != "" {
+			line += " | " + run.Note
+		}
+		fmt.Println(line)
+	}
+}
+
+// checkIdentity makes sure a job's user and group exist and go together.
+// Whether its submitter may use them is antd's call.
+func checkIdentity(userName, groupName string) error {
+	if userName == "" {
+		userName = strconv.Itoa(os.Getuid())
+	}
+	id, err := runner.LookupIdentity(userName, groupName)
+	if err != nil {
+		return err
+	}
+	if !id.InGroup() {
+		return fmt.Errorf("%s is not a member of group %s", id.User.Username, id.Group.Name)
 	}
 	return nil
 }
 
+// checkEnvFile makes sure an env file parses and returns its absolute
+// path, since antd reads it from elsewhere
+func checkEnvFile(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	_, err = runner.ReadEnvFile(abs)
+	return abs, err
+}
+
 // parses action from args
 func parseArgs(args []string) (string, string, error) {
 	if len(args) < 2 {
@@ -152,164 +196,467 @@ func parseArgs(args []string) (string, string, error) {
 	return schedule, command, nil
 }
 
-// ParseSchedule parses schedule strings into a Schedule struct
-func ParseSchedule(input string) (*Schedule, error) {
-	input = strings.TrimSpace(input)
-	schedule := &Schedule{}
+// logPollInterval is how often ant :logs: -f checks for new output
+const logPollInterval = 250 * time.Millisecond
 
-	// Check if it's a repeating schedule
-	if strings.HasPrefix(input, "e ") {
-		schedule.Type = Repeating
-		input = strings.TrimPrefix(input, "e ")
-	} else {
-		schedule.Type = SingleRun
+// LogOptions selects what ShowLogs prints
+type LogOptions struct {
+	RunID  int64         // run to show, 0 for the newest
+	Lines  int           // show only the last lines of each run, 0 for all
+	Since  time.Duration // show every run started this long ago or later
+	Stream string        // logs.Stdout or logs.Stderr, empty for both
+	Follow bool          // keep printing output as it is written, including later runs
+}
+
+// logView is one log file of a run as ShowLogs prints it
+type logView struct {
+	file logs.Run
+	w    io.Writer
+	keep func(line string) bool // nil for every line
+}
+
+// runViews returns what to print of a run's log files, given how its output
+// was captured. Both streams of a separate run go to their own streams.
+func runViews(files []logs.Run, output string, opts LogOptions) []logView {
+	var keep func(string) bool
+	if output == logs.Tagged && (opts.Stream != "" || opts.Since > 0) {
+		filter := logs.Filter{Stream: opts.Stream}
+		if opts.Since > 0 {
+			filter.Since = time.Now().Add(-opts.Since)
+		}
+		keep = filter.Keep
+	}
+
+	var views []logView
+	for _, file := range files {
+		view := logView{file: file, w: os.Stdout, keep: keep}
+		if output == logs.Separate {
+			stream := file.Stream
+			if stream == "" {
+				stream = logs.Stdout
+			}
+			if opts.Stream != "" && stream != opts.Stream {
+				continue
+			}
+			if opts.Stream == "" && stream == logs.Stderr {
+				view.w = os.Stderr
+			}
+		}
+		views = append(views, view)
 	}
+	return views
+}
 
-	// Try to parse as an interval first (15m, 1h, etc)
-	if duration, err := parseInterval(input); err == nil {
-		schedule.Interval = duration
-		schedule.IsInterval = true
-		return schedule, nil
+// ShowLogs prints the output of a job's runs
+func ShowLogs(db *sql.DB, logDir string, jobID int, opts LogOptions) error {
+	runs, err := logs.Runs(logDir, jobID)
+	if err != nil {
+		return err
 	}
 
-	// Split remaining input into day and time parts
-	parts := strings.Fields(input)
-	if len(parts) != 2 {
-		return nil, fmt.Errorf("invalid schedule format: %s", input)
+	// A run may have a log for each stream
+	var ids []int64
+	files := make(map[int64][]logs.Run)
+	for _, run := range runs {
+		if len(files[run.ID]) == 0 {
+			ids = append(ids, run.ID)
+		}
+		files[run.ID] = append(files[run.ID], run)
 	}
 
-	// Parse weekday
-	weekday, err := parseWeekday(parts[0])
+	var selected []int64
+	switch {
+	case opts.RunID > 0:
+		if len(files[opts.RunID]) == 0 {
+			return fmt.Errorf("no log recorded for run %d of job %d", opts.RunID, jobID)
+		}
+		selected = []int64{opts.RunID}
+
+	case opts.Since > 0:
+		started, err := runsStartedSince(db, jobID, time.Now().Add(-opts.Since))
+		if err != nil {
+			return err
+		}
+		for _, id := range ids {
+			if started[id] {
+				selected = append(selected, id)
+			}
+		}
+
+	case len(ids) > 0:
+		selected = ids[len(ids)-1:]
+	}
+
+	if len(selected) == 0 && !opts.Follow {
+		fmt.Printf("No logs recorded for job %d.\n", jobID)
+		return nil
+	}
+
+	outputs, err := runOutputs(db, jobID)
+	if err != nil {
+		return err
+	}
+
+	var views []logView
+	var offsets []int64
+	for _, id := range selected {
+		if len(selected) > 1 {
+			fmt.Printf("==> run %d <==\n", id)
+		}
+		if views, offsets, err = tailRun(files[id], outputs[id], opts); err != nil {
+			return err
+		}
+	}
+	if !opts.Follow {
+		return nil
+	}
+
+	var last int64
+	if len(selected) > 0 {
+		last = selected[len(selected)-1]
+	}
+	return followLogs(db, logDir, jobID, last, views, offsets, opts)
+}
+
+// tailRun prints the end of a run's logs as opts asks, returning what it
+// printed and how far it read into each file
+func tailRun(files []logs.Run, output string, opts LogOptions) ([]logView, []int64, error) {
+	if opts.Stream != "" && output == logs.Combined {
+		fmt.Fprintf(os.Stderr, "Run %d kept stdout and stderr together; showing both.\n", files[0].ID)
+	}
+
+	views := runViews(files, output, opts)
+	offsets := make([]int64, len(views))
+	for i, view := range views {
+		var err error
+		if offsets[i], err = logs.Tail(view.w, view.file, opts.Lines, view.keep); err != nil {
+			return nil, nil, err
+		}
+	}
+	return views, offsets, nil
+}
+
+// runsStartedSince returns the runs of a job that started at or after since
+func runsStartedSince(db *sql.DB, jobID int, since time.Time) (map[int64]bool, error) {
+	rows, err := db.Query("SELECT id FROM job_runs WHERE job_id = ? AND start_time >= ?", jobID, since.Unix())
 	if err != nil {
 		return nil, err
 	}
-	schedule.Weekday = weekday
+	defer rows.Close()
+
+	started := make(map[int64]bool)
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		started[id] = true
+	}
+	return started, rows.Err()
+}
 
-	// Parse time
-	timeOfDay, err := parseTimeOfDay(parts[1])
+// runOutputs returns how the output of each of a job's runs was captured
+func runOutputs(db *sql.DB, jobID int) (map[int64]string, error) {
+	rows, err := db.Query("SELECT id, output FROM job_runs WHERE job_id = ?", jobID)
 	if err != nil {
 		return nil, err
 	}
-	schedule.TimeOfDay = timeOfDay
+	defer rows.Close()
 
-	return schedule, nil
+	outputs := make(map[int64]string)
+	for rows.Next() {
+		var id int64
+		var output string
+		if err := rows.Scan(&id, &output); err != nil {
+			return nil, err
+		}
+		outputs[id] = output
+	}
+	return outputs, rows.Err()
 }
 
-// parseInterval handles duration-based schedules (15m, 1h, etc)
-func parseInterval(input string) (time.Duration, error) {
-	suffixes := map[string]time.Duration{
-		"s": time.Second,
-		"m": time.Minute,
-		"h": time.Hour,
-		"d": time.Hour * 24,
-		"w": time.Hour * 24 * 7,
-	}
-
-	for suffix, unit := range suffixes {
-		if strings.HasSuffix(input, suffix) {
-			value := strings.TrimSuffix(input, suffix)
-			if n, err := strconv.Atoi(value); err == nil {
-				return time.Duration(n) * unit, nil
+// followLogs prints output as the job's runs write it, from offsets in the
+// views of run runID, until interrupted. Once that run is over it moves on
+// to the job's next run.
+func followLogs(db *sql.DB, logDir string, jobID int, runID int64, views []logView, offsets []int64, opts LogOptions) error {
+	followers := make([]*logs.Follower, len(views))
+	closeAll := func() {
+		for i, f := range followers {
+			if f != nil {
+				f.Close()
+				followers[i] = nil
+			}
+		}
+	}
+	defer closeAll()
+
+	poll := func() error {
+		for i, view := range views {
+			if followers[i] == nil && !strings.HasSuffix(view.file.Path, ".gz") {
+				// Logs are created just before their run starts
+				if f, err := logs.Follow(view.file.Path, offsets[i]); err == nil {
+					f.Keep = view.keep
+					followers[i] = f
+				}
+			}
+			if followers[i] != nil {
+				if err := followers[i].Poll(view.w); err != nil {
+					return err
+				}
 			}
 		}
+		return nil
 	}
 
-	return 0, fmt.Errorf("invalid interval format: %s", input)
-}
+	opts.Lines = 0
+	for ; ; time.Sleep(logPollInterval) {
+		if err := poll(); err != nil {
+			return err
+		}
 
-// parseWeekday converts day string to time.Weekday
-func parseWeekday(day string) (time.Weekday, error) {
-	days := map[string]time.Weekday{
-		"sun": time.Sunday,
-		"mon": time.Monday,
-		"tue": time.Tuesday,
-		"wed": time.Wednesday,
-		"thu": time.Thursday,
-		"fri": time.Friday,
-		"sat": time.Saturday,
-	}
+		// Check for a newer run only once this one is over, reading what it
+		// wrote last before moving on
+		var status string
+		err := db.QueryRow("SELECT status FROM job_runs WHERE id = ?", runID).Scan(&status)
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+		if status == "running" || status == "queued" {
+			continue
+		}
+		runs, err := logs.Runs(logDir, jobID)
+		if err != nil {
+			return err
+		}
+
+		var next []logs.Run
+		for _, run := range runs {
+			if run.ID > runID && (len(next) == 0 || run.ID == next[0].ID) {
+				next = append(next, run)
+			}
+		}
+		if len(next) == 0 {
+			continue
+		}
+
+		// The run's output mode is recorded as it starts, after its logs
+		// are created
+		var output string
+		err = db.QueryRow("SELECT status, output FROM job_runs WHERE id = ?", next[0].ID).Scan(&status, &output)
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+		if status == "queued" {
+			continue
+		}
 
-	if weekday, ok := days[strings.ToLower(day)]; ok {
-		return weekday, nil
+		if err := poll(); err != nil {
+			return err
+		}
+		closeAll()
+		fmt.Printf("==> run %d <==\n", next[0].ID)
+		runID = next[0].ID
+		if views, offsets, err = tailRun(next, output, opts); err != nil {
+			return err
+		}
+		followers = make([]*logs.Follower, len(views))
 	}
-	return 0, fmt.Errorf("invalid weekday: %s", day)
 }
 
-// parseTimeOfDay parses time string (HHMM) into time.Time
-func parseTimeOfDay(timeStr string) (time.Time, error) {
-	if len(timeStr) != 4 {
-		return time.Time{}, fmt.Errorf("invalid time format: %s", timeStr)
+// remoteHistory is how many of a job's newest runs ant looks through for
+// the ones to show when reading logs through antd
+const remoteHistory = 1000
+
+// ShowRemoteLogs prints the output of a job's runs as ShowLogs does, read
+// through antd
+func ShowRemoteLogs(client *api.Client, jobID int, opts LogOptions) error {
+	started, err := startedRuns(client, jobID)
+	if err != nil {
+		return err
+	}
+
+	var selected []store.RunRecord
+	switch {
+	case opts.RunID > 0:
+		for _, run := range started {
+			if run.ID == opts.RunID {
+				selected = append(selected, run)
+			}
+		}
+		if len(selected) == 0 {
+			return fmt.Errorf("no log recorded for run %d of job %d", opts.RunID, jobID)
+		}
+
+	case opts.Since > 0:
+		since := time.Now().Add(-opts.Since).Unix()
+		for _, run := range started {
+			if run.Started >= since {
+				selected = append(selected, run)
+			}
+		}
+
+	case len(started) > 0:
+		selected = started[len(started)-1:]
 	}
 
-	hour, err := strconv.Atoi(timeStr[:2])
-	if err != nil || hour < 0 || hour > 23 {
-		return time.Time{}, fmt.Errorf("invalid hour: %s", timeStr[:2])
+	if len(selected) == 0 && !opts.Follow {
+		fmt.Printf("No logs recorded for job %d.\n", jobID)
+		return nil
 	}
 
-	minute, err := strconv.Atoi(timeStr[2:])
-	if err != nil || minute < 0 || minute > 59 {
-		return time.Time{}, fmt.Errorf("invalid minute: %s", timeStr[2:])
+	for i, run := range selected {
+		if len(selected) > 1 {
+			fmt.Printf("==> run %d <==\n", run.ID)
+		}
+		if err := remoteRun(client, run, opts, opts.Follow && i == len(selected)-1); err != nil {
+			return err
+		}
+	}
+	if !opts.Follow {
+		return nil
 	}
 
-	now := time.Now()
-	return time.Date(now.Year(), now.Month(), now.Day(), hour, minute, 0, 0, now.Location()), nil
+	// antd follows a run until it is over, then it's on to the job's next
+	var last int64
+	if len(selected) > 0 {
+		last = selected[len(selected)-1].ID
+	}
+	opts.Lines = 0
+	for ; ; time.Sleep(logPollInterval) {
+		started, err := startedRuns(client, jobID)
+		if err != nil {
+			return err
+		}
+		for _, run := range started {
+			if run.ID > last {
+				fmt.Printf("==> run %d <==\n", run.ID)
+				if err := remoteRun(client, run, opts, true); err != nil {
+					return err
+				}
+				last = run.ID
+				break
+			}
+		}
+	}
 }
 
-// CalculateNextRun determines when the job should next run
-func CalculateNextRun(schedule *Schedule) time.Time {
-	now := time.Now()
+// startedRuns returns the job's recent runs that have started, and so have
+// logs, oldest first
+func startedRuns(client *api.Client, jobID int) ([]store.RunRecord, error) {
+	history, err := client.History(jobID, remoteHistory)
+	if err != nil {
+		return nil, err
+	}
+	var started []store.RunRecord
+	for i := len(history) - 1; i >= 0; i-- {
+		if history[i].Started > 0 {
+			started = append(started, history[i])
+		}
+	}
+	return started, nil
+}
 
-	if schedule.IsInterval {
-		return now.Add(schedule.Interval)
+// remoteRun prints a run's logs through antd as tailRun does, and with
+// follow carries on until the run is over. Both streams of a separate run
+// go to their own streams.
+func remoteRun(client *api.Client, run store.RunRecord, opts LogOptions, follow bool) error {
+	if opts.Stream != "" && run.Output == logs.Combined {
+		fmt.Fprintf(os.Stderr, "Run %d kept stdout and stderr together; showing both.\n", run.ID)
+	}
+	query := api.LogQuery{Stream: opts.Stream, Lines: opts.Lines, Follow: follow}
+	if opts.Since > 0 {
+		query.Since = time.Now().Add(-opts.Since)
+	}
+	if run.Output != logs.Separate || opts.Stream != "" {
+		return client.RunLog(os.Stdout, run.ID, query)
 	}
 
-	targetTime := schedule.TimeOfDay
-	result := time.Date(
-		now.Year(), now.Month(), now.Day(),
-		targetTime.Hour(), targetTime.Minute(), 0, 0,
-		now.Location(),
-	)
+	errQuery := query
+	query.Stream, errQuery.Stream = logs.Stdout, logs.Stderr
+	if !follow {
+		if err := client.RunLog(os.Stdout, run.ID, query); err != nil {
+			return err
+		}
+		return client.RunLog(os.Stderr, run.ID, errQuery)
+	}
 
-	// Adjust the day to match the target weekday
-	for result.Weekday() != schedule.Weekday {
-		result = result.AddDate(0, 0, 1)
+	// Either stream may be written to next, so follow both at once
+	done := make(chan error, 1)
+	go func() { done <- client.RunLog(os.Stderr, run.ID, errQuery) }()
+	err := client.RunLog(os.Stdout, run.ID, query)
+	if errErr := <-done; err == nil {
+		err = errErr
 	}
+	return err
+}
 
-	// If the calculated time is in the past, add appropriate duration
-	if result.Before(now) {
-		if schedule.Type == Repeating {
-			// For repeating schedules, find the next occurrence
-			result = result.AddDate(0, 0, 7)
-		} else {
-			// For single run, add days until we're in the future
-			for result.Before(now) {
-				result = result.AddDate(0, 0, 7)
+// runningJob is a running job and its newest running run, 0 if unknown
+type runningJob struct {
+	store.JobStatus
+	runID int64
+}
+
+// runningJobs lists the running jobs from antd if it is running, and
+// otherwise from the database
+func runningJobs(client *api.Client, db *sql.DB) ([]runningJob, error) {
+	if client != nil {
+		jobs, err := client.Jobs()
+		if err != nil {
+			return nil, err
+		}
+		var running []runningJob
+		for _, job := range jobs {
+			if job.PID <= 0 {
+				continue
 			}
+			history, err := client.History(job.ID, remoteHistory)
+			if err != nil {
+				return nil, err
+			}
+			entry := runningJob{JobStatus: job}
+			for _, run := range history {
+				if run.Status == "running" {
+					entry.runID = run.ID
+					break
+				}
+			}
+			running = append(running, entry)
 		}
+		return running, nil
 	}
 
-	return result
-}
-
-// ShowJobs spawns a tmux multipane terminal for all running jobs
-func ShowJobs(db *sql.DB) error {
-	rows, err := db.Query("SELECT id, command, pid FROM jobs WHERE pid > 0")
+	rows, err := db.Query(`
+		SELECT id, command, pid,
+			(SELECT MAX(id) FROM job_runs WHERE job_id = jobs.id AND status = 'running')
+		FROM jobs WHERE pid > 0`)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer rows.Close()
 
-	var runningJobs []Job
+	var running []runningJob
 	for rows.Next() {
-		var job Job
-		err := rows.Scan(&job.ID, &job.Command, &job.PID)
-		if err != nil {
-			return err
+		var job runningJob
+		var runID sql.NullInt64
+		if err := rows.Scan(&job.ID, &job.Command, &job.PID, &runID); err != nil {
+			return nil, err
 		}
-		runningJobs = append(runningJobs, job)
+		job.runID = runID.Int64
+		running = append(running, job)
 	}
+	return running, rows.Err()
+}
 
-	if len(runningJobs) == 0 {
+// shellQuote quotes s for a POSIX shell
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// ShowJobs spawns a tmux multipane terminal for all running jobs, each
+// following the log of the job's newest run with ant, the command given
+// with its global flags
+func ShowJobs(jobs []runningJob, ant []string) error {
+	if len(jobs) == 0 {
 		fmt.Println("No running jobs found.")
 		return nil
 	}
@@ -321,7 +668,7 @@ func ShowJobs(db *sql.DB) error {
 		return fmt.Errorf("failed to create tmux session: %v", err)
 	}
 
-	for i, job := range runningJobs {
+	for i, job := range jobs {
 		if i > 0 {
 			cmd = exec.Command("tmux", "split-window", "-h", "-t", sessionName)
 			if err := cmd.Run(); err != nil {
@@ -337,7 +684,14 @@ func ShowJobs(db *sql.DB) error {
 			return fmt.Errorf("failed to send info command to tmux pane: %v", err)
 		}
 
-		tailCommand := fmt.Sprintf("tail -f nohup.%d", job.PID)
+		tailCommand := "echo 'No log recorded for this run'"
+		if job.runID > 0 {
+			var words []string
+			for _, arg := range ant {
+				words = append(words, shellQuote(arg))
+			}
+			tailCommand = fmt.Sprintf("%s :logs: %d --run %d -f", strings.Join(words, " "), job.ID, job.runID)
+		}
 		cmd = exec.Command("tmux", "send-keys", "-t", 
 			fmt.Sprintf("%s:%d", sessionName, i), tailCommand, "C-m")
 		if err := cmd.Run(); err != nil {
@@ -349,191 +703,501 @@ func ShowJobs(db *sql.DB) error {
 	return cmd.Run()
 }
 
-// DeleteJob removes a job from the database and kills its process if running
-func DeleteJob(db *sql.DB, jobID int) error {
-	var pid int
-	err := db.QueryRow("SELECT pid FROM jobs WHERE id = ?", jobID).Scan(&pid)
-	if err != nil {
-		if err == sql.ErrNoRows {
-			return fmt.Errorf("job %d not found", jobID)
+// ShowDeps prints the dependency graph as trees, from jobs that depend on
+// nothing down to the jobs that run after them. Given a job ID it prints
+// only the tree below that job.
+func ShowDeps(jobs []store.JobStatus, jobID int) error {
+	graph := make(map[int][]int)
+	for _, job := range jobs {
+		if len(job.After) > 0 {
+			graph[job.ID] = job.After
 		}
-		return err
 	}
 
-	if pid > 0 {
-		cmd := exec.Command("pkill", "-P", strconv.Itoa(pid))
-		if err := cmd.Run(); err != nil {
-			fmt.Printf("Warning: Failed to kill process %d: %v\n", pid, err)
+	dependents := make(map[int][]int)
+	for id, deps := range graph {
+		for _, dep := range deps {
+			dependents[dep] = append(dependents[dep], id)
 		}
 	}
-
-	_, err = db.Exec("DELETE FROM jobs WHERE id = ?", jobID)
-	return err
-}
-
-// StartScheduledJob starts a scheduled job and updates its PID and last_run time
-func StartScheduledJob(db *sql.DB, jobID int, command string) error {
-	cmd := exec.Command("bash", "-c", command)
-	
-	logFile, err := os.OpenFile(fmt.Sprintf("nohup.%d", jobID), 
-		os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
-	if err != nil {
-		return fmt.Errorf("failed to create log file: %v", err)
+	for _, ids := range dependents {
+		sort.Ints(ids)
 	}
-	defer logFile.Close()
-
-	cmd.Stdout = logFile
-	cmd.Stderr = logFile
 
-	if err := cmd.Start(); err != nil {
-		return fmt.Errorf("failed to start process: %v", err)
+	labels := make(map[int]string)
+	for _, job := range jobs {
+		labels[job.ID] = fmt.Sprintf("%d | %s", job.ID, job.Command)
+		if len(job.After) > 1 {
+			labels[job.ID] += fmt.Sprintf(" (after %s of %s)", job.DepsMode, joinIDs(job.After))
+		}
 	}
 
-	now := time.Now()
-	_, err = db.Exec(
-		"UPDATE jobs SET pid = ?, last_run = ? WHERE id = ?",
-		cmd.Process.Pid,
-		now.Unix(),
-		jobID,
-	)
-	if err != nil {
-		cmd.Process.Kill()
-		return fmt.Errorf("failed to update job status: %v", err)
+	var roots []int
+	if jobID > 0 {
+		if _, ok := labels[jobID]; !ok {
+			return fmt.Errorf("job %d not found", jobID)
+		}
+		if deps := graph[jobID]; len(deps) == 1 {
+			fmt.Printf("Job %d runs after job %d\n", jobID, deps[0])
+		}
+		roots = []int{jobID}
+	} else {
+		for id := range dependents {
+			if len(graph[id]) == 0 {
+				roots = append(roots, id)
+			}
+		}
+		sort.Ints(roots)
 	}
 
-	cmd.Process.Release()
+	if len(roots) == 0 {
+		fmt.Println("No job dependencies.")
+		return nil
+	}
 
-	fmt.Printf("Started job %d with PID %d at %s\n", 
-		jobID, cmd.Process.Pid, now.Format("2006-01-02 15:04:05"))
+	var printDependents func(id int, prefix string)
+	printDependents = func(id int, prefix string) {
+		for i, child := range dependents[id] {
+			branch, indent := "├── ", "│   "
+			if i == len(dependents[id])-1 {
+				branch, indent = "└── ", "    "
+			}
+			fmt.Println(prefix + branch + labels[child])
+			printDependents(child, prefix+indent)
+		}
+	}
+	for _, root := range roots {
+		fmt.Println(labels[root])
+		printDependents(root, "")
+	}
 	return nil
 }
 
-// StartWatchJob starts a job that runs every 2 seconds indefinitely
-func StartWatchJob(db *sql.DB, jobID int, command string) error {
-	watchScript := fmt.Sprintf(`while true; do
-		%s
-		sleep 2
-	done`, command)
+// parseIDs parses a comma separated list of job IDs
+func parseIDs(input string) ([]int, error) {
+	var ids []int
+	for _, field := range strings.Split(input, ",") {
+		id, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil || id <= 0 {
+			return nil, fmt.Errorf("invalid job ID: %s", field)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
 
-	cmd := exec.Command("bash", "-c", watchScript)
-	
-	logFile, err := os.OpenFile(fmt.Sprintf("nohup.%d", jobID), 
-		os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
-	if err != nil {
-		return fmt.Errorf("failed to create log file: %v", err)
+// joinIDs formats job IDs as a comma separated list
+func joinIDs(ids []int) string {
+	parts := make([]string, len(ids))
+	for i, id := range ids {
+		parts[i] = strconv.Itoa(id)
 	}
-	defer logFile.Close()
+	return strings.Join(parts, ", ")
+}
 
-	cmd.Stdout = logFile
-	cmd.Stderr = logFile
+func main() {
+	// Global flags come before the action
+	flags := flag.NewFlagSet("ant", flag.ContinueOnError)
+	dbFlag := flags.String("db", "", "path to the job database (default $ANT_DB, then the data directory)")
+	systemFlag := flags.Bool("system", false, "use the system-wide database in "+store.SystemDir)
+	socketFlag := flags.String("socket", "", "antd's control socket (default next to the database)")
+
+	// Job flags apply to the job being added
+	var opts store.JobOptions
+	flags.IntVar(&opts.Retry.MaxAttempts, "max-attempts", 1, "attempts per run before giving up on a failure")
+	flags.DurationVar(&opts.Retry.Delay, "retry-delay", 10*time.Second, "wait before the first retry")
+	flags.Float64Var(&opts.Retry.Backoff, "retry-backoff", runner.DefaultBackoff, "multiply the wait by this for each further retry")
+	flags.Float64Var(&opts.Retry.Jitter, "retry-jitter", 0, "randomly spread each wait by up to this fraction of it")
+	retryOn := flags.String("retry-on", "", "comma separated exit codes to retry (default any failure)")
+	flags.DurationVar(&opts.Timeout, "timeout", 0, "stop a run that takes longer than this (default no limit)")
+	flags.DurationVar(&opts.KillGrace, "kill-grace", runner.DefaultKillGrace, "wait after SIGTERM before sending SIGKILL on timeout")
+	overlap := flags.String("overlap", "forbid", "when a run comes due during another: forbid, queue, replace or allow")
+	flags.IntVar(&opts.MaxParallel, "max-parallel", 1, "runs allowed at once with --overlap allow")
+	flags.StringVar(&opts.Pool, "pool", "", "concurrency pool to join; antd --pool sets its limit")
+	flags.IntVar(&opts.Priority, "priority", 0, "higher goes first when runs wait for a free slot")
+	after := flags.String("after", "", "comma separated jobs that must all succeed to trigger this one")
+	afterAny := flags.String("after-any", "", "comma separated jobs any one of which triggers this one on success")
+	flags.IntVar(&opts.Limits.CPUWeight, "cpu-weight", 0, "relative share of CPU time, 1-10000 (default 100)")
+	flags.IntVar(&opts.Limits.CPUQuota, "cpu-quota", 0, "most CPU to use as a percentage of one CPU, e.g. 150 (default no limit)")
+	memoryMax := flags.String("memory-max", "", "most memory to use, e.g. 512M or 2G (default no limit)")
+	flags.IntVar(&opts.Limits.PidsMax, "pids-max", 0, "most processes and threads at once (default no limit)")
+	flags.IntVar(&opts.Limits.IOWeight, "io-weight", 0, "relative share of disk IO, 1-10000 (default 100)")
+	flags.StringVar(&opts.User, "user", "", "user to run the job as (default you)")
+	flags.StringVar(&opts.Group, "group", "", "group to run the job as (default the user's primary group)")
+	flags.StringVar(&opts.Cwd, "cwd", "", "directory to run the job in (default the database's directory)")
+	umask := flags.String("umask", "", "octal file mode mask for the job, e.g. 027 (default antd's)")
+	flags.Func("env", "set an environment variable as KEY=VALUE; may be repeated", func(pair string) error {
+		opts.Env = append(opts.Env, pair)
+		return nil
+	})
+	flags.Func("env-file", "read environment variables from an .env file at each run; may be repeated", func(path string) error {
+		opts.EnvFiles = append(opts.EnvFiles, path)
+		return nil
+	})
+	flags.BoolVar(&opts.ClearEnv, "clear-env", false, "start from an empty environment rather than antd's")
+	flags.IntVar(&opts.LogKeep, "log-keep", 0, "logs of finished runs to keep (default antd's --log-keep)")
+	flags.StringVar(&opts.Output, "output", logs.Combined, "how to log stdout and stderr: combined, separate or tagged")
 
-	if err := cmd.Start(); err != nil {
-		return fmt.Errorf("failed to start watch process: %v", err)
+	if err := flags.Parse(os.Args[1:]); err != nil {
+		return
 	}
+	args := append([]string{os.Args[0]}, flags.Args()...)
 
-	now := time.Now()
-	_, err = db.Exec(
-		"UPDATE jobs SET pid = ?, last_run = ? WHERE id = ?",
-		cmd.Process.Pid,
-		now.Unix(),
-		jobID,
-	)
-	if err != nil {
-		cmd.Process.Kill()
-		return fmt.Errorf("failed to update job status: %v", err)
+	if len(args) < 2 {
+		fmt.Println("Usage: ant [--db <path>] [--system] [job flags] :<schedule>: <command> | ant :: <command> | ant :jobs: | ant :history: <id> | ant :deps: [id] | ant :logs: <id> | ant :run: <id> | ant :pause: <id> | ant :resume: <id> | ant :kill: <run> | ant :x: <id> | ant :reload: | ant :mon: | ant :where:")
+		return
 	}
 
-	cmd.Process.Release()
-
-	fmt.Printf("Started watch job %d with PID %d at %s\n", 
-		jobID, cmd.Process.Pid, now.Format("2006-01-02 15:04:05"))
-
-	return nil
-} 
-
-func main() {
-	if len(os.Args) < 2 {
-		fmt.Println("Usage: ant :<schedule>: <command> | ant :: <command> | ant :jobs: | ant :mon:")
+	// Root always uses the system-wide database, like antd
+	dbPath, err := store.Path(*dbFlag, *systemFlag || os.Geteuid() == 0)
+	if err != nil {
+		fmt.Println("Error locating database:", err)
 		return
 	}
 
-	db, err := initDB()
+	opts.Retry.ExitCodes, err = runner.ParseExitCodes(*retryOn)
+	if err == nil {
+		opts.Overlap, err = runner.ParseOverlap(*overlap)
+	}
+	if err == nil && *after != "" && *afterAny != "" {
+		err = fmt.Errorf("use either after or after-any, not both")
+	}
+	if err == nil && *after != "" {
+		opts.After, err = parseIDs(*after)
+	}
+	if err == nil && *afterAny != "" {
+		opts.After, err = parseIDs(*afterAny)
+		opts.AfterAny = true
+	}
+	if err == nil && *memoryMax != "" {
+		opts.Limits.MemoryMax, err = runner.ParseBytes(*memoryMax)
+	}
+	opts.Umask = -1
+	if err == nil && *umask != "" {
+		var mask uint64
+		if mask, err = strconv.ParseUint(*umask, 8, 32); err != nil {
+			err = fmt.Errorf("invalid umask: %s", *umask)
+		}
+		opts.Umask = int(mask)
+	}
+	if err == nil {
+		opts.Output, err = logs.ParseOutput(opts.Output)
+	}
+	if err == nil && opts.Cwd != "" {
+		opts.Cwd, err = filepath.Abs(opts.Cwd)
+	}
+	if err == nil && (opts.User != "" || opts.Group != "") {
+		err = checkIdentity(opts.User, opts.Group)
+	}
+	for i, path := range opts.EnvFiles {
+		if err == nil {
+			opts.EnvFiles[i], err = checkEnvFile(path)
+		}
+	}
+	if err == nil {
+		err = opts.Validate()
+	}
 	if err != nil {
-		fmt.Println("Error initializing database:", err)
+		fmt.Println("Error in job options:", err)
 		return
 	}
-	defer db.Close()
 
 	// Get first argument to determine action
-	action := os.Args[1]
+	action := args[1]
+
+	if action == ":where:" {
+		fmt.Println(dbPath)
+		return
+	}
+
+	// Every change goes through antd. Reading jobs and their logs goes
+	// through it too when it is running, and otherwise straight to the
+	// database and the log files.
+	socketPath := *socketFlag
+	if socketPath == "" {
+		socketPath = api.SocketPath(dbPath)
+	}
+	client, clientErr := api.Dial(socketPath)
+	if client != nil {
+		defer client.Close()
+	}
+
+	reachable := func() bool {
+		if client == nil {
+			fmt.Printf("Error: antd is not reachable at %s: %v\n", socketPath, clientErr)
+		}
+		return client != nil
+	}
+
+	var db *sql.DB
+	switch action {
+	case ":jobs:", ":history:", ":deps:", ":logs:", ":mon:":
+		if client == nil {
+			if db, err = initDB(dbPath); err != nil {
+				fmt.Println("Error initializing database:", err)
+				return
+			}
+			defer db.Close()
+		}
+	}
 
 	switch {
 	case action == "::":
 		// Handle watch command
-		if len(os.Args) < 3 {
+		if len(args) < 3 {
 			fmt.Println("Usage: ant :: <command>")
 			return
 		}
-		command := strings.Join(os.Args[2:], " ")
-		jobID, err := AddJob(db, "", command, time.Now())
-		if err != nil {
-			fmt.Println("Error adding job:", err)
+		if !reachable() {
 			return
 		}
-		err = StartWatchJob(db, int(jobID), command)
+		command := strings.Join(args[2:], " ")
+		added, err := client.AddJob(api.NewJobSpec("", command, opts))
 		if err != nil {
-			fmt.Println("Error starting watch job:", err)
+			fmt.Println("Error adding job:", err)
+			return
 		}
+		fmt.Printf("Added watch job %d; antd starts it now\n", added.ID)
 
 	case action == ":x:":
-		if len(os.Args) != 3 {
+		if len(args) != 3 {
 			fmt.Println("Usage: ant :x: <job_id>")
 			return
 		}
-		jobID, err := strconv.Atoi(os.Args[2])
+		jobID, err := strconv.Atoi(args[2])
 		if err != nil {
 			fmt.Printf("Invalid job ID: %v\n", err)
 			return
 		}
-		if err := DeleteJob(db, jobID); err != nil {
+		if !reachable() {
+			return
+		}
+		if err := client.DeleteJob(jobID); err != nil {
 			fmt.Printf("Error deleting job: %v\n", err)
 			return
 		}
 		fmt.Printf("Job %d deleted successfully\n", jobID)
 
+	case action == ":history:":
+		if len(args) < 3 || len(args) > 4 {
+			fmt.Println("Usage: ant :history: <job_id> [count]")
+			return
+		}
+		jobID, err := strconv.Atoi(args[2])
+		if err != nil {
+			fmt.Printf("Invalid job ID: %v\n", err)
+			return
+		}
+		limit := 20
+		if len(args) == 4 {
+			limit, err = strconv.Atoi(args[3])
+			if err != nil || limit <= 0 {
+				fmt.Printf("Invalid count: %s\n", args[3])
+				return
+			}
+		}
+		var runs []store.RunRecord
+		if client != nil {
+			runs, err = client.History(jobID, limit)
+		} else {
+			runs, err = store.History(db, jobID, limit)
+		}
+		if err != nil {
+			fmt.Println("Error showing history:", err)
+			return
+		}
+		ShowHistory(runs, jobID)
+
+	case action == ":deps:":
+		if len(args) > 3 {
+			fmt.Println("Usage: ant :deps: [job_id]")
+			return
+		}
+		jobID := 0
+		if len(args) == 3 {
+			jobID, err = strconv.Atoi(args[2])
+			if err != nil {
+				fmt.Printf("Invalid job ID: %v\n", err)
+				return
+			}
+		}
+		jobs, err := listJobs(client, db)
+		if err == nil {
+			err = ShowDeps(jobs, jobID)
+		}
+		if err != nil {
+			fmt.Println("Error showing dependencies:", err)
+		}
+
 	case action == ":jobs:":
-		err := ListJobs(db)
+		jobs, err := listJobs(client, db)
 		if err != nil {
 			fmt.Println("Error listing jobs:", err)
+			return
+		}
+		ListJobs(jobs)
+
+	case action == ":run:":
+		if len(args) != 3 {
+			fmt.Println("Usage: ant :run: <job_id>")
+			return
+		}
+		jobID, err := strconv.Atoi(args[2])
+		if err != nil {
+			fmt.Printf("Invalid job ID: %v\n", err)
+			return
+		}
+		if !reachable() {
+			return
+		}
+		queued, err := client.RunJob(jobID)
+		if err != nil {
+			fmt.Println("Error running job:", err)
+			return
+		}
+		fmt.Printf("Queued run %d of job %d\n", queued.RunID, jobID)
+
+	case action == ":pause:" || action == ":resume:":
+		if len(args) != 3 {
+			fmt.Printf("Usage: ant %s <job_id>\n", action)
+			return
+		}
+		jobID, err := strconv.Atoi(args[2])
+		if err != nil {
+			fmt.Printf("Invalid job ID: %v\n", err)
+			return
+		}
+		if !reachable() {
+			return
+		}
+		if action == ":pause:" {
+			err = client.PauseJob(jobID)
+		} else {
+			err = client.ResumeJob(jobID)
+		}
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		fmt.Printf("Job %d %sd\n", jobID, strings.Trim(action, ":"))
+
+	case action == ":kill:":
+		if len(args) != 3 {
+			fmt.Println("Usage: ant :kill: <run_id>")
+			return
+		}
+		runID, err := strconv.ParseInt(args[2], 10, 64)
+		if err != nil {
+			fmt.Printf("Invalid run ID: %v\n", err)
+			return
+		}
+		if !reachable() {
+			return
+		}
+		if err := client.KillRun(runID); err != nil {
+			fmt.Println("Error stopping run:", err)
+			return
+		}
+		fmt.Printf("Run %d stopped\n", runID)
+
+	case action == ":reload:":
+		if !reachable() {
+			return
+		}
+		if err := client.Reload(); err != nil {
+			fmt.Println("Error reloading antd:", err)
+			return
+		}
+		fmt.Println("antd reloaded")
+
+	case action == ":logs:":
+		if len(args) < 3 {
+			fmt.Println("Usage: ant :logs: <job_id> [--run N] [-f] [-n lines] [--since 1h] [--stream out|err]")
+			return
+		}
+		jobID, err := strconv.Atoi(args[2])
+		if err != nil {
+			fmt.Printf("Invalid job ID: %v\n", err)
+			return
+		}
+		var logOpts LogOptions
+		logFlags := flag.NewFlagSet("ant :logs:", flag.ContinueOnError)
+		logFlags.Int64Var(&logOpts.RunID, "run", 0, "run to show (default the newest)")
+		logFlags.BoolVar(&logOpts.Follow, "f", false, "keep printing output as it is written, including later runs")
+		logFlags.IntVar(&logOpts.Lines, "n", 0, "show only the last lines of each run (default all)")
+		logFlags.DurationVar(&logOpts.Since, "since", 0, "show every run started within this long")
+		logFlags.StringVar(&logOpts.Stream, "stream", "", "show only stdout or stderr: out or err")
+		if err := logFlags.Parse(args[3:]); err != nil {
+			return
+		}
+		if logFlags.NArg() > 0 || logOpts.Lines < 0 || logOpts.Since < 0 || (logOpts.RunID > 0 && logOpts.Since > 0) ||
+			(logOpts.Stream != "" && logOpts.Stream != logs.Stdout && logOpts.Stream != logs.Stderr) {
+			fmt.Println("Usage: ant :logs: <job_id> [--run N] [-f] [-n lines] [--since 1h] [--stream out|err]")
+			return
+		}
+		if client != nil {
+			err = ShowRemoteLogs(client, jobID, logOpts)
+		} else {
+			err = ShowLogs(db, logs.Dir(dbPath), jobID, logOpts)
+		}
+		if err != nil {
+			fmt.Println("Error showing logs:", err)
 		}
 
 	case action == ":mon:":
-		err := ShowJobs(db)
+		jobs, err := runningJobs(client, db)
+		if err == nil {
+			// Each pane follows its job with ant :logs: on this database
+			ant, exeErr := os.Executable()
+			if exeErr != nil {
+				ant = os.Args[0]
+			}
+			err = ShowJobs(jobs, []string{ant, "--db", dbPath, "--socket", socketPath})
+		}
 		if err != nil {
 			fmt.Println("Error showing jobs:", err)
 		}
 
 	default:
 		// Handle scheduled commands
-		schedule, command, err := parseArgs(os.Args)
+		scheduleStr, command, err := parseArgs(args)
 		if err != nil {
 			fmt.Printf("Error parsing arguments: %v\n", err)
-			fmt.Println("Usage: ant :<schedule>: <command>")
+			fmt.Println("Usage: ant :[key=value ...] <schedule>: <command>")
 			return
 		}
 
-		parsedSchedule, err := ParseSchedule(schedule)
+		parsedSchedule, err := schedule.Parse(scheduleStr)
 		if err != nil {
 			fmt.Printf("Error parsing schedule: %v\n", err)
 			return
 		}
 
-		nextRun := CalculateNextRun(parsedSchedule)
-		jobID, err := AddJob(db, schedule, command, nextRun)
+		now := time.Now()
+		nextRun := schedule.CalculateNextRun(parsedSchedule, now)
+		if !parsedSchedule.At.IsZero() && nextRun.Before(now) {
+			fmt.Printf("Error parsing schedule: %s is in the past\n",
+				nextRun.Format("2006-01-02 15:04:05"))
+			return
+		}
+
+		if !reachable() {
+			return
+		}
+		added, err := client.AddJob(api.NewJobSpec(scheduleStr, command, opts))
 		if err != nil {
 			fmt.Printf("Error adding job: %v\n", err)
 			return
 		}
-		fmt.Printf("Scheduled job %d to run at %v\n", jobID, nextRun)
+		jobID := added.ID
+		if parsedSchedule.AtReboot {
+			fmt.Printf("Scheduled job %d to run whenever antd starts\n", jobID)
+			return
+		}
+		if parsedSchedule.Manual {
+			fmt.Printf("Added job %d; it runs only when triggered\n", jobID)
+			return
+		}
+		fmt.Printf("Scheduled job %d to run at %s\n", jobID, time.Unix(added.NextRun, 0).Format("2006-01-02 15:04:05 MST"))
 	}
 }
\ No newline at end of file
@@ -1,348 +1,1933 @@
-package main
-
-import (
-	"database/sql"
-	"daemon"
-	"fmt"
-	"log"
-	"os"
-	"os/exec"
-	"os/signal"
-	"path/filepath"
-	"strings"
-	"sync"
-	"syscall"
-	"time"
-
-	_ "github.com/mattn/go-sqlite3"
-)
-
-// ScheduleType represents the type of schedule (single run or repeating)
-type ScheduleType int
-
-const (
-	SingleRun ScheduleType = iota
-	Repeating
-)
-
-// Schedule represents a parsed schedule configuration
-type Schedule struct {
-	Type      ScheduleType
-	Weekday   time.Weekday
-	TimeOfDay time.Time
-	Interval  time.Duration
-	IsInterval bool
-}
-
-// Helper function to parse intervals like "15m", "1h", etc.
-func parseInterval(input string) (time.Duration, error) {
-	return time.ParseDuration(input)
-}
-
-// Helper function to parse weekday strings
-func parseWeekday(input string) (time.Weekday, error) {
-	weekdays := map[string]time.Weekday{
-		"sun": time.Sunday,
-		"mon": time.Monday,
-		"tue": time.Tuesday,
-		"wed": time.Wednesday,
-		"thu": time.Thursday,
-		"fri": time.Friday,
-		"sat": time.Saturday,
-	}
-
-	day, exists := weekdays[strings.ToLower(input)]
-	if !exists {
-		return 0, fmt.Errorf("invalid weekday: %s", input)
-	}
-	return day, nil
-}
-
-// Helper function to parse time strings like "15:04"
-func parseTimeOfDay(input string) (time.Time, error) {
-	t, err := time.Parse("15:04", input)
-	if err != nil {
-		return time.Time{}, fmt.Errorf("invalid time format: %s", input)
-	}
-	return t, nil
-}
-
-const (
-	dbPath        = "./ant.db3"
-	pollInterval  = 1 * time.Second
-	logTimeFormat = "2006-01-02 15:04:05"
-)
-
-// Job represents a scheduled job with Unix timestamps
-type Job struct {
-	ID       int
-	Schedule string
-	Command  string
-	PID      int
-	NextRun  int64
-	LastRun  int64
-}
-
-type Daemon struct {
-	db        *sql.DB
-	logger    *log.Logger
-	wg        sync.WaitGroup
-	stopChan  chan struct{}
-	jobsMutex sync.Mutex
-}
-
-func NewDaemon(db *sql.DB) *Daemon {
-	// Create logger
-	logFile, err := os.OpenFile("antd.log", os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
-	if err != nil {
-		log.Fatal("Failed to open log file:", err)
-	}
-
-	logger := log.New(logFile, "", log.LstdFlags)
-
-	return &Daemon{
-		db:       db,
-		logger:   logger,
-		stopChan: make(chan struct{}),
-	}
-}
-
-func (d *Daemon) Start() {
-	d.logger.Println("Daemon starting...")
-	
-	// Set up signal handling
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
-
-	// Start the main monitoring loop
-	d.wg.Add(1)
-	go d.monitorJobs()
-
-	// Wait for shutdown signal
-	sig := <-sigChan
-	d.logger.Printf("Received signal %v, shutting down...", sig)
-	close(d.stopChan)
-	d.wg.Wait()
-	d.logger.Println("Daemon stopped")
-}
-
-func (d *Daemon) monitorJobs() {
-	defer d.wg.Done()
-
-	ticker := time.NewTicker(pollInterval)
-	defer ticker.Stop()
-
-	for {
-		select {
-		case <-d.stopChan:
-			return
-		case <-ticker.C:
-			if err := d.checkAndExecuteJobs(); err != nil {
-				d.logger.Printf("Error checking jobs: %v", err)
-			}
-		}
-	}
-}
-
-func (d *Daemon) checkAndExecuteJobs() error {
-	d.jobsMutex.Lock()
-	defer d.jobsMutex.Unlock()
-
-	now := time.Now().Unix()
-	
-	// Query for jobs that are due to run
-	rows, err := d.db.Query(`
-		SELECT id, schedule, command, pid, next_run, last_run 
-		FROM jobs 
-		WHERE next_run <= ? AND (pid = 0 OR pid IS NULL)`,
-		now,
-	)
-	if err != nil {
-		return fmt.Errorf("query failed: %v", err)
-	}
-	defer rows.Close()
-
-	for rows.Next() {
-		var job Job
-		err := rows.Scan(&job.ID, &job.Schedule, &job.Command, &job.PID, &job.NextRun, &job.LastRun)
-		if err != nil {
-			d.logger.Printf("Error scanning job: %v", err)
-			continue
-		}
-
-		// Execute the job
-		if err := d.executeJob(&job); err != nil {
-			d.logger.Printf("Error executing job %d: %v", job.ID, err)
-			continue
-		}
-
-		// Calculate and update the next run time if it's a repeating job
-		if err := d.updateJobSchedule(&job); err != nil {
-			d.logger.Printf("Error updating job %d schedule: %v", job.ID, err)
-		}
-	}
-
-	return nil
-}
-
-func (d *Daemon) executeJob(job *Job) error {
-	d.logger.Printf("Executing job %d: %s", job.ID, job.Command)
-
-	// Create log file for the job
-	logFile, err := os.OpenFile(
-		fmt.Sprintf("nohup.%d", job.ID),
-		os.O_CREATE|os.O_APPEND|os.O_WRONLY,
-		0644,
-	)
-	if err != nil {
-		return fmt.Errorf("failed to create log file: %v", err)
-	}
-	defer logFile.Close()
-
-	// Prepare command
-	cmd := exec.Command("bash", "-c", job.Command)
-	cmd.Stdout = logFile
-	cmd.Stderr = logFile
-	
-	// Set working directory to the same directory as the database
-	cmd.Dir = filepath.Dir(dbPath)
-
-	// Start the command
-	if err := cmd.Start(); err != nil {
-		return fmt.Errorf("failed to start process: %v", err)
-	}
-
-	// Update job status in database
-	now := time.Now().Unix()
-	_, err = d.db.Exec(
-		"UPDATE jobs SET pid = ?, last_run = ? WHERE id = ?",
-		cmd.Process.Pid,
-		now,
-		job.ID,
-	)
-	if err != nil {
-		cmd.Process.Kill()
-		return fmt.Errorf("failed to update job status: %v", err)
-	}
-
-	// Start a goroutine to monitor the process completion
-	go func() {
-		cmd.Wait()
-		d.jobsMutex.Lock()
-		defer d.jobsMutex.Unlock()
-		
-		_, err := d.db.Exec("UPDATE jobs SET pid = 0 WHERE id = ?", job.ID)
-		if err != nil {
-			d.logger.Printf("Error updating job %d PID after completion: %v", job.ID, err)
-		}
-	}()
-
-	d.logger.Printf("Started job %d with PID %d", job.ID, cmd.Process.Pid)
-	return nil
-}
-
-func (d *Daemon) updateJobSchedule(job *Job) error {
-	if job.Schedule == "" {
-		// Non-repeating job, no need to update schedule
-		return nil
-	}
-
-	// Parse the schedule string
-	schedule, err := ParseSchedule(job.Schedule)
-	if err != nil {
-		return fmt.Errorf("failed to parse schedule: %v", err)
-	}
-
-	// Calculate next run time
-	nextRun := CalculateNextRun(schedule)
-
-	// Update the database
-	_, err = d.db.Exec(
-		"UPDATE jobs SET next_run = ? WHERE id = ?",
-		nextRun.Unix(),
-		job.ID,
-	)
-	if err != nil {
-		return fmt.Errorf("failed to update next run time: %v", err)
-	}
-
-	d.logger.Printf("Updated job %d next run time to %s", job.ID, nextRun.Format(logTimeFormat))
-	return nil
-}
-
-// ParseSchedule parses schedule strings into a Schedule struct
-func ParseSchedule(input string) (*Schedule, error) {
-	input = strings.TrimSpace(input)
-	schedule := &Schedule{}
-
-	// Check if it's a repeating schedule
-	if strings.HasPrefix(input, "e ") {
-		schedule.Type = Repeating
-		input = strings.TrimPrefix(input, "e ")
-	} else {
-		schedule.Type = SingleRun
-	}
-
-	// Try to parse as an interval first (15m, 1h, etc)
-	if duration, err := parseInterval(input); err == nil {
-		schedule.Interval = duration
-		schedule.IsInterval = true
-		return schedule, nil
-	}
-
-	// Split remaining input into day and time parts
-	parts := strings.Fields(input)
-	if len(parts) != 2 {
-		return nil, fmt.Errorf("invalid schedule format: %s", input)
-	}
-
-	// Parse weekday
-	weekday, err := parseWeekday(parts[0])
-	if err != nil {
-		return nil, err
-	}
-	schedule.Weekday = weekday
-
-	// Parse time
-	timeOfDay, err := parseTimeOfDay(parts[1])
-	if err != nil {
-		return nil, err
-	}
-	schedule.TimeOfDay = timeOfDay
-
-	return schedule, nil
-}
-
-func main() {
-	// Set up logging to work with systemd
-	logger := log.New(os.Stdout, "", log.LstdFlags)
-	
-	// Update default paths for systemd service
-	dbPath := "/var/lib/antd/ant.db3"
-	
-	// Open database connection
-	db, err := sql.Open("sqlite3", dbPath)
-	if err != nil {
-		logger.Fatal("Failed to open database:", err)
-	}
-	defer db.Close()
-
-	// Send startup notification to systemd
-	if os.Getenv("NOTIFY_SOCKET") != "" {
-		daemon.SdNotify(false, daemon.SdNotifyReady)
-	}
-
-	// Create and start the daemon
-	d := NewDaemon(db)
-	
-	// Update logger to use systemd's stdout
-	d.logger = logger
-	
-	// Start the daemon
-	d.Start()
-
-	// Notify systemd of clean shutdown
-	if os.Getenv("NOTIFY_SOCKET") != "" {
-		daemon.SdNotify(false, daemon.SdNotifyStopping)
-	}
+package main
+
+import (
+	"database/sql"
+	"daemon"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"os/signal"
+	"os/user"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/gagehenrich/ant/api"
+	"github.com/gagehenrich/ant/logs"
+	"github.com/gagehenrich/ant/runner"
+	"github.com/gagehenrich/ant/schedule"
+	"github.com/gagehenrich/ant/store"
+)
+
+const (
+	pollInterval  = 1 * time.Second
+	logTimeFormat = "2006-01-02 15:04:05"
+
+	// logMaintenanceInterval is how often job logs are rotated and pruned
+	logMaintenanceInterval = 1 * time.Minute
+
+	// watchInterval is the pause between commands of a :: watch loop
+	watchInterval = 2 * time.Second
+
+	// followInterval is how often a followed run's log is checked for new
+	// output
+	followInterval = 250 * time.Millisecond
+)
+
+// Job represents a scheduled job with Unix timestamps
+type Job struct {
+	ID       int
+	Schedule string
+	Command  string
+	PID      int
+	NextRun  int64
+	LastRun  int64
+
+	Retry          runner.RetryPolicy
+	RetryAt        int64 // when the pending retry is due, 0 if none
+	RetryAttempt   int   // attempt number of the pending retry
+	RetryScheduled int64 // scheduled time of the run being retried
+
+	Timeout   time.Duration // 0 for no limit
+	KillGrace time.Duration // wait between SIGTERM and SIGKILL on timeout
+
+	Overlap     runner.Overlap
+	MaxParallel int           // runs allowed at once under runner.Allow
+	QueuedRun   sql.NullInt64 // job_runs ID of the oldest queued run
+	QueuedCount int           // number of queued runs
+
+	Pool     string // concurrency pool the job belongs to, if any
+	Priority int    // higher goes first when runs wait for a slot
+
+	Limits runner.Limits // cgroup resource limits
+
+	User         string // user to run as, empty for the submitter
+	Group        string // group to run as, empty for the user's primary group
+	Cwd          string // working directory, empty for the database's directory
+	Umask        int    // -1 to inherit antd's
+	SubmittedUID int    // user who added the job, -1 if not recorded
+
+	Env      []string // KEY=VALUE pairs
+	EnvFiles []string // .env files, read at each run
+	EnvMode  string   // runner.EnvInherit or runner.EnvClear
+
+	Output string // how stdout and stderr are captured, see logs.Combined
+}
+
+// parallelLimit returns how many runs of the job may go at once
+func (j *Job) parallelLimit() int {
+	if j.Overlap == runner.Allow && j.MaxParallel > 1 {
+		return j.MaxParallel
+	}
+	return 1
+}
+
+// pendingRun is a run about to be started
+type pendingRun struct {
+	scheduled time.Time // the scheduled time it stands in for
+	attempt   int       // 1 for a first attempt, higher for retries
+	runID     int64     // job_runs row of a queued run, or 0 to add one
+}
+
+// launch is a run about to be started and the job it belongs to
+type launch struct {
+	job *Job
+	run pendingRun
+}
+
+// activeRun is a run the daemon started that has not finished yet
+type activeRun struct {
+	runID    int64
+	pid      int
+	pool     string
+	replaced bool // stopped to make way for a newer run
+	killed   bool // stopped through the API, so not retried
+}
+
+type Daemon struct {
+	db        *sql.DB
+	dbPath    string
+	logger    *log.Logger
+	host      string
+	wg        sync.WaitGroup
+	stopChan  chan struct{}
+	jobsMutex sync.Mutex
+
+	// running holds the unfinished runs of each job, guarded by jobsMutex
+	running map[int][]*activeRun
+
+	maxJobs int            // runs allowed at once across all jobs, 0 for no limit
+	pools   map[string]int // runs allowed at once in each named pool
+
+	cgroups *runner.Cgroups // nil to run jobs without cgroups
+
+	runAs     *runner.RunAsPolicy // who may run jobs as whom, guarded by jobsMutex
+	runAsPath string              // file the policy is read from, empty for none
+
+	logDir    string      // where runs write their output
+	logPolicy logs.Policy // how much of it to keep
+
+	listener     net.Listener  // the control API's socket, nil if it is off
+	httpListener net.Listener  // the API's localhost port, nil if it is off
+	tokens       *api.Tokens   // tokens the port accepts, guarded by jobsMutex
+	tokensPath   string        // file the tokens are read from
+	wake         chan struct{} // makes the poll loop check for due jobs now
+}
+
+func NewDaemon(db *sql.DB, dbPath string) *Daemon {
+	// Create logger
+	logFile, err := os.OpenFile("antd.log", os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		log.Fatal("Failed to open log file:", err)
+	}
+
+	logger := log.New(logFile, "", log.LstdFlags)
+
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+
+	return &Daemon{
+		db:       db,
+		dbPath:   dbPath,
+		logDir:   logs.Dir(dbPath),
+		logger:   logger,
+		host:     host,
+		stopChan: make(chan struct{}),
+		running:  make(map[int][]*activeRun),
+		wake:     make(chan struct{}, 1),
+	}
+}
+
+func (d *Daemon) Start() {
+	d.logger.Println("Daemon starting...")
+	
+	// Set up signal handling
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+
+	if err := d.scheduleRebootJobs(); err != nil {
+		d.logger.Printf("Error scheduling @reboot jobs: %v", err)
+	}
+
+	// Start the main monitoring loop
+	d.wg.Add(2)
+	go d.monitorJobs()
+	go d.maintainLogs()
+
+	// Serve the control API on the socket, and to token holders on the
+	// localhost port
+	var servers []*http.Server
+	serve := func(l net.Listener, server *http.Server) {
+		servers = append(servers, server)
+		d.wg.Add(1)
+		go func() {
+			defer d.wg.Done()
+			if err := server.Serve(l); err != http.ErrServerClosed {
+				d.logger.Printf("Error serving API on %s: %v", l.Addr(), err)
+			}
+		}()
+	}
+	if d.listener != nil {
+		serve(d.listener, &http.Server{Handler: d.apiHandler(), ConnContext: api.ConnContext})
+	}
+	if d.httpListener != nil {
+		serve(d.httpListener, &http.Server{Handler: d.authenticate(d.apiHandler()), ReadHeaderTimeout: 10 * time.Second})
+	}
+
+	// Wait for shutdown signal; SIGHUP reloads
+	sig := <-sigChan
+	for sig == syscall.SIGHUP {
+		if err := d.reload(); err != nil {
+			d.logger.Printf("Error reloading: %v", err)
+		}
+		sig = <-sigChan
+	}
+	d.logger.Printf("Received signal %v, shutting down...", sig)
+	close(d.stopChan)
+	for _, server := range servers {
+		server.Close()
+	}
+	d.wg.Wait()
+	d.logger.Println("Daemon stopped")
+}
+
+func (d *Daemon) monitorJobs() {
+	defer d.wg.Done()
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-d.stopChan:
+			return
+		case <-ticker.C:
+		case <-d.wake:
+		}
+		if err := d.checkAndExecuteJobs(); err != nil {
+			d.logger.Printf("Error checking jobs: %v", err)
+		}
+	}
+}
+
+// wakeUp makes the poll loop check for due jobs without waiting for its
+// next tick
+func (d *Daemon) wakeUp() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// maintainLogs rotates and prunes job logs until the daemon stops
+func (d *Daemon) maintainLogs() {
+	defer d.wg.Done()
+
+	ticker := time.NewTicker(logMaintenanceInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-d.stopChan:
+			return
+		case <-ticker.C:
+			if err := d.applyLogPolicy(); err != nil {
+				d.logger.Printf("Error maintaining job logs: %v", err)
+			}
+		}
+	}
+}
+
+// applyLogPolicy rotates the logs of unfinished runs and compresses and
+// prunes the rest, keeping as many runs per job as the job asks for
+func (d *Daemon) applyLogPolicy() error {
+	// Runs added after this was read count as unfinished too
+	var lastRun int64
+	if err := d.db.QueryRow("SELECT COALESCE(MAX(id), 0) FROM job_runs").Scan(&lastRun); err != nil {
+		return err
+	}
+	unfinished := make(map[int64]bool)
+	rows, err := d.db.Query("SELECT id FROM job_runs WHERE status IN ('running', 'queued')")
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		unfinished[id] = true
+	}
+	rows.Close()
+
+	keep := make(map[int]int)
+	rows, err = d.db.Query("SELECT id, log_keep FROM jobs WHERE log_keep > 0")
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var id, n int
+		if err := rows.Scan(&id, &n); err != nil {
+			rows.Close()
+			return err
+		}
+		keep[id] = n
+	}
+	rows.Close()
+
+	active := func(runID int64) bool { return runID > lastRun || unfinished[runID] }
+	return logs.Maintain(d.logDir, d.logPolicy, active, keep)
+}
+
+func (d *Daemon) checkAndExecuteJobs() error {
+	d.jobsMutex.Lock()
+	defer d.jobsMutex.Unlock()
+
+	now := time.Now().Unix()
+	
+	// Query for jobs that are due to run or due a retry, leaving paused
+	// ones until they are resumed
+	rows, err := d.db.Query(`
+		SELECT id, schedule, command, pid, next_run, last_run,
+			retry_max_attempts, retry_delay_ms, retry_backoff, retry_jitter, retry_exit_codes,
+			retry_at, retry_attempt, retry_scheduled, timeout_ms, kill_grace_ms,
+			overlap, max_parallel, pool, priority,
+			cpu_weight, cpu_quota, memory_max, pids_max, io_weight,
+			run_user, run_group, cwd, umask, submitted_uid, env, env_files, env_mode,
+			output,
+			(SELECT MIN(id) FROM job_runs WHERE job_id = jobs.id AND status = 'queued') AS queued_run,
+			(SELECT COUNT(*) FROM job_runs WHERE job_id = jobs.id AND status = 'queued')
+		FROM jobs 
+		WHERE ((next_run > 0 AND next_run <= ?) OR (retry_at > 0 AND retry_at <= ?) OR queued_run IS NOT NULL)
+			AND (schedule != '' OR pid = 0 OR pid IS NULL) AND paused = 0`,
+		now, now,
+	)
+	if err != nil {
+		return fmt.Errorf("query failed: %v", err)
+	}
+
+	// Read every due job before acting on any of them, since SQLite won't
+	// let the updates below commit while the query is still open
+	var due []Job
+	for rows.Next() {
+		var job Job
+		var retryDelayMs, timeoutMs, killGraceMs int64
+		var retryExitCodes, overlap, env, envFiles string
+		err := rows.Scan(&job.ID, &job.Schedule, &job.Command, &job.PID, &job.NextRun, &job.LastRun,
+			&job.Retry.MaxAttempts, &retryDelayMs, &job.Retry.Backoff, &job.Retry.Jitter, &retryExitCodes,
+			&job.RetryAt, &job.RetryAttempt, &job.RetryScheduled, &timeoutMs, &killGraceMs,
+			&overlap, &job.MaxParallel, &job.Pool, &job.Priority,
+			&job.Limits.CPUWeight, &job.Limits.CPUQuota, &job.Limits.MemoryMax, &job.Limits.PidsMax, &job.Limits.IOWeight,
+			&job.User, &job.Group, &job.Cwd, &job.Umask, &job.SubmittedUID, &env, &envFiles, &job.EnvMode,
+			&job.Output,
+			&job.QueuedRun, &job.QueuedCount)
+		if err != nil {
+			d.logger.Printf("Error scanning job: %v", err)
+			continue
+		}
+		job.Retry.Delay = time.Duration(retryDelayMs) * time.Millisecond
+		job.Timeout = time.Duration(timeoutMs) * time.Millisecond
+		job.KillGrace = time.Duration(killGraceMs) * time.Millisecond
+		job.Env = splitLines(env)
+		job.EnvFiles = splitLines(envFiles)
+		if job.Retry.ExitCodes, err = runner.ParseExitCodes(retryExitCodes); err != nil {
+			d.logger.Printf("Error reading job %d retry exit codes: %v", job.ID, err)
+		}
+		if job.Overlap, err = runner.ParseOverlap(overlap); err != nil {
+			d.logger.Printf("Error reading job %d overlap policy: %v", job.ID, err)
+		}
+		due = append(due, job)
+	}
+	rows.Close()
+
+	// Work out what each job wants to start, then start as much of it as
+	// the concurrency limits allow, highest priority first
+	var launches []launch
+	for i := range due {
+		job := &due[i]
+
+		// A queued run goes first once the runs ahead of it have finished
+		if job.QueuedRun.Valid && len(d.running[job.ID]) < job.parallelLimit() {
+			run, err := d.queuedRun(job)
+			if err != nil {
+				d.logger.Printf("Error reading queued run of job %d: %v", job.ID, err)
+			} else {
+				launches = append(launches, launch{job, run})
+			}
+		}
+
+		switch {
+		case job.NextRun > 0 && job.NextRun <= now:
+			// A pending retry waits no longer than the job's next run,
+			// which supersedes it whether or not it goes ahead
+			if job.RetryAt > 0 {
+				d.logger.Printf("Job %d gave up retrying: its next run is due", job.ID)
+				if _, err := d.db.Exec("UPDATE jobs SET retry_at = 0 WHERE id = ?", job.ID); err != nil {
+					d.logger.Printf("Error updating job %d retry time: %v", job.ID, err)
+				}
+				job.RetryAt = 0
+			}
+			if run, ok := d.planDue(job); ok {
+				launches = append(launches, launch{job, run})
+			}
+
+		case job.RetryAt > 0 && job.RetryAt <= now:
+			// Retries wait for room rather than being skipped
+			if len(d.running[job.ID])+job.QueuedCount >= job.parallelLimit() {
+				continue
+			}
+			run := pendingRun{scheduled: time.Unix(job.RetryScheduled, 0), attempt: job.RetryAttempt}
+			launches = append(launches, launch{job, run})
+		}
+	}
+
+	sort.SliceStable(launches, func(i, j int) bool {
+		a, b := launches[i], launches[j]
+		if a.job.Priority != b.job.Priority {
+			return a.job.Priority > b.job.Priority
+		}
+		return a.run.scheduled.Before(b.run.scheduled)
+	})
+	for _, l := range launches {
+		d.launch(l.job, l.run)
+	}
+
+	return nil
+}
+
+// planDue handles a job whose next run has come due: it applies the
+// misfire and overlap policies, moves the job on to its next run and
+// returns the run to start, if any
+func (d *Daemon) planDue(job *Job) (pendingRun, bool) {
+	// Watch jobs have no schedule of their own; their loop is a single run
+	if job.Schedule == "" {
+		if _, err := d.db.Exec("UPDATE jobs SET next_run = 0 WHERE id = ?", job.ID); err != nil {
+			d.logger.Printf("Error updating job %d schedule: %v", job.ID, err)
+		}
+		return pendingRun{scheduled: time.Unix(job.NextRun, 0), attempt: 1}, true
+	}
+
+	parsed, err := schedule.Parse(job.Schedule)
+	if err != nil {
+		d.logger.Printf("Error parsing job %d schedule: %v", job.ID, err)
+		return pendingRun{}, false
+	}
+
+	// Decide how to handle runs missed while the daemon was down
+	plan := schedule.PlanRun(parsed, time.Unix(job.NextRun, 0), time.Now())
+	if plan.Skipped > 0 {
+		skipped := strconv.Itoa(plan.Skipped)
+		if plan.Uncounted {
+			skipped = "over " + skipped
+		}
+		d.logger.Printf("Job %d skipped %s missed run(s) from %s",
+			job.ID, skipped, time.Unix(job.NextRun, 0).Format(logTimeFormat))
+		note := fmt.Sprintf("%s missed run(s) skipped by misfire policy", skipped)
+		if err := d.recordSkipped(job, time.Unix(job.NextRun, 0), note); err != nil {
+			d.logger.Printf("Error recording skipped runs of job %d: %v", job.ID, err)
+		}
+	}
+
+	if plan.Run && !d.admit(job, plan.Scheduled) {
+		plan.Run = false
+	}
+	if plan.Run && plan.Scheduled.Unix() != job.NextRun {
+		d.logger.Printf("Job %d catching up on run missed at %s",
+			job.ID, plan.Scheduled.Format(logTimeFormat))
+	}
+
+	// Calculate and update the next run time
+	if err := d.updateJobSchedule(job, parsed, plan); err != nil {
+		d.logger.Printf("Error updating job %d schedule: %v", job.ID, err)
+	}
+	return pendingRun{scheduled: plan.Scheduled, attempt: 1}, plan.Run
+}
+
+// admit applies the job's overlap policy to a run that has come due and
+// reports whether it may go ahead. A run that has to wait for the current
+// one is queued, and one that may not happen at all is recorded as skipped.
+func (d *Daemon) admit(job *Job, scheduled time.Time) bool {
+	runs := d.running[job.ID]
+	if len(runs)+job.QueuedCount < job.parallelLimit() {
+		return true
+	}
+
+	note := "previous run still running"
+	switch {
+	case job.Overlap == runner.Allow && len(runs) < job.parallelLimit():
+		// Runs waiting for a free slot don't crowd out the new run, which
+		// waits behind them
+		d.logger.Printf("Job %d has runs waiting for a free slot, queueing run for %s", job.ID, scheduled.Format(logTimeFormat))
+		if _, err := d.recordQueued(job.ID, pendingRun{scheduled: scheduled, attempt: 1}, ""); err != nil {
+			d.logger.Printf("Error queueing run of job %d: %v", job.ID, err)
+		}
+		return false
+
+	case job.QueuedCount > 0:
+		note = "a run is already queued"
+
+	case job.Overlap == runner.Queue:
+		d.logger.Printf("Job %d is still running, queueing run for %s", job.ID, scheduled.Format(logTimeFormat))
+		if _, err := d.recordQueued(job.ID, pendingRun{scheduled: scheduled, attempt: 1}, ""); err != nil {
+			d.logger.Printf("Error queueing run of job %d: %v", job.ID, err)
+		}
+		return false
+
+	case job.Overlap == runner.Replace:
+		for _, run := range runs {
+			d.logger.Printf("Job %d stopping run with PID %d to replace it", job.ID, run.pid)
+			run.replaced = true
+			go func(pgid int) {
+				if err := runner.StopGroup(pgid, job.KillGrace); err != nil {
+					d.logger.Printf("Error stopping job %d: %v", job.ID, err)
+				}
+			}(run.pid)
+		}
+		return true
+	}
+
+	d.logger.Printf("Job %d skipped run for %s: %s", job.ID, scheduled.Format(logTimeFormat), note)
+	if err := d.recordSkipped(job, scheduled, note); err != nil {
+		d.logger.Printf("Error recording skipped run of job %d: %v", job.ID, err)
+	}
+	return false
+}
+
+// queuedRun returns the oldest queued run of a job
+func (d *Daemon) queuedRun(job *Job) (pendingRun, error) {
+	var scheduled int64
+	run := pendingRun{runID: job.QueuedRun.Int64}
+	err := d.db.QueryRow("SELECT scheduled_time, attempt FROM job_runs WHERE id = ?", run.runID).
+		Scan(&scheduled, &run.attempt)
+	run.scheduled = time.Unix(scheduled, 0)
+	return run, err
+}
+
+// launch starts a run if the concurrency limits leave room for it, and
+// otherwise queues it to be started once they do
+func (d *Daemon) launch(job *Job, run pendingRun) {
+	if !d.hasSlot(job) {
+		if run.runID > 0 {
+			return // already queued
+		}
+		d.logger.Printf("Job %d is waiting for a free slot", job.ID)
+		if _, err := d.recordQueued(job.ID, run, ""); err != nil {
+			d.logger.Printf("Error queueing run of job %d: %v", job.ID, err)
+			return
+		}
+		// A queued retry is no longer pending as a retry
+		if run.attempt > 1 {
+			if _, err := d.db.Exec("UPDATE jobs SET retry_at = 0 WHERE id = ?", job.ID); err != nil {
+				d.logger.Printf("Error updating job %d retry time: %v", job.ID, err)
+			}
+		}
+		return
+	}
+
+	if run.runID > 0 {
+		d.logger.Printf("Starting queued run of job %d", job.ID)
+	} else if run.attempt > 1 {
+		d.logger.Printf("Retrying job %d (attempt %d of %d)", job.ID, run.attempt, job.Retry.MaxAttempts)
+	}
+	// A new run gets its history row up front, since its ID goes in its
+	// environment
+	var err error
+	if run.runID == 0 {
+		note := ""
+		if job.Schedule == "" {
+			note = "watch loop"
+		}
+		run.runID, err = d.recordQueued(job.ID, run, note)
+	}
+	if err == nil {
+		if err = d.executeJob(job, run); err != nil {
+			if err := d.recordFailedStart(run.runID, err); err != nil {
+				d.logger.Printf("Error recording failed start of job %d: %v", job.ID, err)
+			}
+		}
+	}
+	if err != nil {
+		d.logger.Printf("Error executing job %d: %v", job.ID, err)
+		// A fixed-delay job would otherwise be left without a next run
+		if err := d.scheduleAfterCompletion(job); err != nil {
+			d.logger.Printf("Error updating job %d schedule: %v", job.ID, err)
+		}
+	}
+}
+
+// hasSlot reports whether the daemon-wide limit and the limit of the job's
+// pool leave room for another run. The caller must hold jobsMutex.
+func (d *Daemon) hasSlot(job *Job) bool {
+	total, inPool := 0, 0
+	for _, runs := range d.running {
+		for _, run := range runs {
+			total++
+			if job.Pool != "" && run.pool == job.Pool {
+				inPool++
+			}
+		}
+	}
+
+	if d.maxJobs > 0 && total >= d.maxJobs {
+		return false
+	}
+	if limit, ok := d.pools[job.Pool]; ok && job.Pool != "" && inPool >= limit {
+		return false
+	}
+	return true
+}
+
+// scheduleRebootJobs marks every @reboot job as due now. Their next_run is
+// otherwise left at 0 so they only fire once per daemon start.
+func (d *Daemon) scheduleRebootJobs() error {
+	rows, err := d.db.Query("SELECT id, schedule FROM jobs WHERE schedule != ''")
+	if err != nil {
+		return fmt.Errorf("query failed: %v", err)
+	}
+
+	var due []int
+	for rows.Next() {
+		var id int
+		var scheduleStr string
+		if err := rows.Scan(&id, &scheduleStr); err != nil {
+			rows.Close()
+			return err
+		}
+		if parsed, err := schedule.Parse(scheduleStr); err == nil && parsed.AtReboot {
+			due = append(due, id)
+		}
+	}
+	rows.Close()
+
+	now := time.Now().Unix()
+	for _, id := range due {
+		if _, err := d.db.Exec("UPDATE jobs SET next_run = ? WHERE id = ?", now, id); err != nil {
+			return fmt.Errorf("failed to schedule job %d: %v", id, err)
+		}
+		d.logger.Printf("Scheduled @reboot job %d", id)
+	}
+	return nil
+}
+
+// executeJob starts a run of the job. The caller must hold jobsMutex.
+func (d *Daemon) executeJob(job *Job, run pendingRun) error {
+	d.logger.Printf("Executing job %d: %s", job.ID, job.Command)
+
+	// Refuse to start a run as a user the policy doesn't allow
+	id, err := d.identity(job)
+	if err != nil {
+		return err
+	}
+	env, err := d.environment(job, run, id)
+	if err != nil {
+		return fmt.Errorf("failed to build environment: %v", err)
+	}
+
+	// Prepare command; a watch job runs its command in a loop until stopped
+	script := job.Command
+	if job.Schedule == "" {
+		script = fmt.Sprintf("while true; do\n%s\nsleep %d\ndone", job.Command, int(watchInterval.Seconds()))
+	}
+	// The shell sets the umask, since exec can only set it for antd as a whole
+	if job.Umask >= 0 {
+		script = fmt.Sprintf("umask %04o\n%s", job.Umask, script)
+	}
+	cmd := exec.Command("bash", "-c", script)
+	cmd.Env = env
+
+	// Send its output to the run's log files
+	closeLogs, err := logs.Capture(cmd, d.logDir, job.ID, run.runID, job.Output)
+	if err != nil {
+		return fmt.Errorf("failed to create log file: %v", err)
+	}
+	defer closeLogs()
+
+	// Lead a process group of its own so stopping it stops everything it spawned
+	cmd.SysProcAttr = runner.GroupAttr()
+	if !id.IsCurrent() {
+		cmd.SysProcAttr.Credential = id.Credential()
+	}
+
+	// Start it in a cgroup of its own to apply its limits and measure it
+	cgroup := d.createCgroup(job)
+	if cgroup != nil {
+		cgroup.Apply(cmd.SysProcAttr)
+	}
+	
+	// Run in the job's directory, by default the same directory as the database
+	cmd.Dir = job.Cwd
+	if cmd.Dir == "" {
+		cmd.Dir = filepath.Dir(d.dbPath)
+	}
+
+	// Start the command
+	if err := cmd.Start(); err != nil {
+		if cgroup != nil {
+			cgroup.Remove()
+		}
+		return fmt.Errorf("failed to start process: %v", err)
+	}
+
+	// Update job status in database; any pending retry is now under way or
+	// superseded
+	started := time.Now()
+	_, err = d.db.Exec(
+		"UPDATE jobs SET pid = ?, last_run = ?, last_status = 'running', retry_at = 0 WHERE id = ?",
+		cmd.Process.Pid,
+		started.Unix(),
+		job.ID,
+	)
+	if err != nil {
+		cmd.Process.Kill()
+		return fmt.Errorf("failed to update job status: %v", err)
+	}
+
+	if err := d.recordRunStart(run.runID, started, cmd.Process.Pid, job.Output); err != nil {
+		d.logger.Printf("Error recording start of job %d: %v", job.ID, err)
+	}
+
+	active := &activeRun{runID: run.runID, pid: cmd.Process.Pid, pool: job.Pool}
+	d.running[job.ID] = append(d.running[job.ID], active)
+
+	// Stop the run if it outlives its timeout
+	var timer *time.Timer
+	if job.Timeout > 0 {
+		pgid := cmd.Process.Pid
+		timer = time.AfterFunc(job.Timeout, func() {
+			d.logger.Printf("Job %d timed out after %s, stopping it", job.ID, job.Timeout)
+			if err := runner.StopGroup(pgid, job.KillGrace); err != nil {
+				d.logger.Printf("Error stopping job %d: %v", job.ID, err)
+			}
+		})
+	}
+
+	// Start a goroutine to monitor the process completion
+	go func() {
+		cmd.Wait()
+		ended := time.Now()
+
+		// Removing the cgroup stops anything the run left behind in it
+		var usage runner.Usage
+		if cgroup != nil {
+			usage = cgroup.Usage()
+			if err := cgroup.Remove(); err != nil {
+				d.logger.Printf("Error removing cgroup of job %d: %v", job.ID, err)
+			}
+		}
+		d.jobsMutex.Lock()
+		defer d.jobsMutex.Unlock()
+		
+		result := runOutcome(cmd.ProcessState)
+		// A timer that can no longer be stopped has already fired
+		if timer != nil && !timer.Stop() {
+			result.status = "timeout"
+		}
+		if active.replaced {
+			result.status = "replaced"
+		}
+		if active.killed {
+			result.status = "killed"
+		}
+
+		pid := d.finishRun(job.ID, active)
+		if err := d.recordJobOutcome(job.ID, pid, result); err != nil {
+			d.logger.Printf("Error updating job %d status after completion: %v", job.ID, err)
+		}
+		d.logger.Printf("Job %d finished: %s (exit %d)", job.ID, result.status, result.exitCode)
+
+		if err := d.recordRunEnd(run.runID, result, started, ended, usage); err != nil {
+			d.logger.Printf("Error recording end of job %d: %v", job.ID, err)
+		}
+
+		// The run that replaced this one takes over from here
+		if active.replaced {
+			return
+		}
+
+		if result.status == "ok" {
+			if err := d.triggerDependents(job.ID); err != nil {
+				d.logger.Printf("Error triggering jobs that depend on job %d: %v", job.ID, err)
+			}
+		}
+
+		if !active.killed && job.Retry.ShouldRetry(run.attempt, result.status, result.exitCode) {
+			if err := d.scheduleRetry(job, run.scheduled, run.attempt, ended); err != nil {
+				d.logger.Printf("Error scheduling retry of job %d: %v", job.ID, err)
+			}
+			return
+		}
+
+		if err := d.scheduleAfterCompletion(job); err != nil {
+			d.logger.Printf("Error updating job %d schedule: %v", job.ID, err)
+		}
+	}()
+
+	d.logger.Printf("Started job %d with PID %d", job.ID, cmd.Process.Pid)
+	return nil
+}
+
+// identity returns the user and group a run of the job starts as. Jobs
+// run as whoever added them unless they name another user, which the
+// run-as policy must allow.
+func (d *Daemon) identity(job *Job) (*runner.Identity, error) {
+	if job.SubmittedUID < 0 {
+		if job.User != "" || job.Group != "" {
+			return nil, fmt.Errorf("job has no recorded submitter to check its user against")
+		}
+		// Added before submitters were recorded
+		return runner.LookupIdentity(strconv.Itoa(os.Getuid()), "")
+	}
+
+	name := job.User
+	if name == "" {
+		name = strconv.Itoa(job.SubmittedUID)
+	}
+	id, err := runner.LookupIdentity(name, job.Group)
+	if err != nil {
+		return nil, err
+	}
+
+	submitter, err := user.LookupId(strconv.Itoa(job.SubmittedUID))
+	if err != nil {
+		return nil, fmt.Errorf("unknown submitter %d", job.SubmittedUID)
+	}
+	if err := d.runAs.Allows(submitter, id); err != nil {
+		return nil, err
+	}
+
+	if !id.IsCurrent() && os.Geteuid() != 0 {
+		return nil, fmt.Errorf("antd must run as root to run jobs as %s", id)
+	}
+	return id, nil
+}
+
+// environment builds the environment of a run: antd's own unless the job
+// clears it, then the job's env files and variables, then the variables
+// that tell the run about itself
+func (d *Daemon) environment(job *Job, run pendingRun, id *runner.Identity) ([]string, error) {
+	env := [][]string{os.Environ()}
+	if job.EnvMode == runner.EnvClear {
+		env = [][]string{{"PATH=" + runner.DefaultPath}, id.Env()}
+	} else if !id.IsCurrent() {
+		env = append(env, id.Env())
+	}
+
+	for _, path := range job.EnvFiles {
+		// antd may be able to read files the run's user can't
+		if !id.IsCurrent() {
+			if err := id.CanRead(path); err != nil {
+				return nil, err
+			}
+		}
+		vars, err := runner.ReadEnvFile(path)
+		if err != nil {
+			return nil, err
+		}
+		env = append(env, vars)
+	}
+
+	env = append(env, job.Env, []string{
+		fmt.Sprintf("ANT_JOB_ID=%d", job.ID),
+		fmt.Sprintf("ANT_RUN_ID=%d", run.runID),
+		fmt.Sprintf("ANT_SCHEDULED_TIME=%d", run.scheduled.Unix()),
+		fmt.Sprintf("ANT_ATTEMPT=%d", run.attempt),
+	})
+	return runner.MergeEnv(env...), nil
+}
+
+// splitLines splits a column holding one value per line
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\n")
+}
+
+// createCgroup makes the cgroup for a run of the job, or returns nil if
+// the run has to go without one
+func (d *Daemon) createCgroup(job *Job) *runner.Cgroup {
+	if d.cgroups == nil {
+		if !job.Limits.IsZero() {
+			d.logger.Printf("Cgroups are unavailable, running job %d without its resource limits", job.ID)
+		}
+		return nil
+	}
+
+	name := fmt.Sprintf("job-%d-%d", job.ID, time.Now().UnixNano())
+	cgroup, err := d.cgroups.Create(name, job.Limits)
+	if err != nil {
+		d.logger.Printf("Error creating cgroup for job %d, running it without resource limits: %v", job.ID, err)
+		return nil
+	}
+	return cgroup
+}
+
+// finishRun forgets a run that has finished and returns the PID of the
+// job's newest run still going, or 0 if there is none. The caller must hold
+// jobsMutex.
+func (d *Daemon) finishRun(jobID int, finished *activeRun) int {
+	runs := d.running[jobID]
+	for i, run := range runs {
+		if run == finished {
+			runs = append(runs[:i], runs[i+1:]...)
+			break
+		}
+	}
+
+	if len(runs) == 0 {
+		delete(d.running, jobID)
+		return 0
+	}
+	d.running[jobID] = runs
+	return runs[len(runs)-1].pid
+}
+
+// recordJobOutcome updates a job after one of its runs finished. pid is
+// that of a run still going, if any, in which case the job stays running.
+// A replaced run leaves the job's outcome to the run that replaced it.
+func (d *Daemon) recordJobOutcome(jobID, pid int, result outcome) error {
+	if result.status == "replaced" {
+		_, err := d.db.Exec("UPDATE jobs SET pid = ? WHERE id = ?", pid, jobID)
+		return err
+	}
+
+	lastStatus := result.status
+	if pid > 0 {
+		lastStatus = "running"
+	}
+	_, err := d.db.Exec(
+		`UPDATE jobs SET pid = ?, last_exit_code = ?, last_status = ?,
+			fail_count = CASE WHEN ? = 'ok' THEN 0 ELSE fail_count + 1 END
+		WHERE id = ?`,
+		pid,
+		result.exitCode,
+		lastStatus,
+		result.status,
+		jobID,
+	)
+	return err
+}
+
+// recordRunStart records that a run has just started in its job_runs row
+func (d *Daemon) recordRunStart(runID int64, started time.Time, pid int, output string) error {
+	_, err := d.db.Exec(
+		"UPDATE job_runs SET start_time = ?, pid = ?, host = ?, status = 'running', output = ? WHERE id = ?",
+		started.Unix(),
+		pid,
+		d.host,
+		output,
+		runID,
+	)
+	return err
+}
+
+// outcome is how a run ended
+type outcome struct {
+	status   string // ok, failed, killed, timeout or replaced
+	exitCode int    // -1 if the process was killed by a signal
+	signal   int    // 0 unless the process was killed by a signal
+}
+
+// runOutcome classifies the state of a finished process
+func runOutcome(state *os.ProcessState) outcome {
+	result := outcome{status: "failed", exitCode: -1}
+	if state == nil {
+		return result
+	}
+
+	result.exitCode = state.ExitCode()
+	if ws, ok := state.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+		result.status = "killed"
+		result.signal = int(ws.Signal())
+	} else if state.Success() {
+		result.status = "ok"
+	}
+	return result
+}
+
+// recordRunEnd fills in the outcome of a finished run and what it consumed,
+// leaving usage that wasn't measured NULL
+func (d *Daemon) recordRunEnd(runID int64, result outcome, started, ended time.Time, usage runner.Usage) error {
+	_, err := d.db.Exec(
+		`UPDATE job_runs SET end_time = ?, duration_ms = ?, exit_code = ?, signal = ?, status = ?,
+			peak_memory_bytes = ?, cpu_usec = ?
+		WHERE id = ?`,
+		ended.Unix(),
+		ended.Sub(started).Milliseconds(),
+		result.exitCode,
+		result.signal,
+		result.status,
+		sql.NullInt64{Int64: usage.PeakMemory, Valid: usage.PeakMemory > 0},
+		sql.NullInt64{Int64: usage.CPUTime.Microseconds(), Valid: usage.CPUTime > 0},
+		runID,
+	)
+	return err
+}
+
+// recordFailedStart records why a run could not be started
+func (d *Daemon) recordFailedStart(runID int64, reason error) error {
+	_, err := d.db.Exec(
+		"UPDATE job_runs SET status = 'failed', note = ? WHERE id = ?",
+		fmt.Sprintf("failed to start: %v", reason),
+		runID,
+	)
+	return err
+}
+
+// recordSkipped adds a job_runs row noting runs that were dropped and why
+func (d *Daemon) recordSkipped(job *Job, scheduled time.Time, note string) error {
+	_, err := d.db.Exec(
+		`INSERT INTO job_runs (job_id, scheduled_time, host, status, note)
+		VALUES (?, ?, ?, 'skipped', ?)`,
+		job.ID,
+		scheduled.Unix(),
+		d.host,
+		note,
+	)
+	return err
+}
+
+// recordQueued adds a job_runs row for a run waiting for an earlier run of
+// the job to finish or for a free slot, and returns its ID. The daemon
+// starts the run from there.
+func (d *Daemon) recordQueued(jobID int, run pendingRun, note string) (int64, error) {
+	result, err := d.db.Exec(
+		`INSERT INTO job_runs (job_id, scheduled_time, attempt, host, status, note)
+		VALUES (?, ?, ?, ?, 'queued', ?)`,
+		jobID,
+		run.scheduled.Unix(),
+		run.attempt,
+		d.host,
+		note,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// triggerDependents queues a run of each job whose dependencies are met now
+// that jobID has succeeded
+func (d *Daemon) triggerDependents(jobID int) error {
+	ready, err := store.SatisfyDeps(d.db, jobID)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ready {
+		d.logger.Printf("Job %d triggered by job %d", id, jobID)
+		run := pendingRun{scheduled: time.Now(), attempt: 1}
+		if _, err := d.recordQueued(id, run, fmt.Sprintf("triggered by job %d", jobID)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *Daemon) updateJobSchedule(job *Job, parsed *schedule.Schedule, plan schedule.Plan) error {
+	// Fixed-delay jobs that were started are rescheduled once they
+	// complete, and have no next run until then
+	if plan.Run && parsed.Mode == schedule.FixedDelay {
+		if _, err := d.db.Exec("UPDATE jobs SET next_run = 0 WHERE id = ?", job.ID); err != nil {
+			return fmt.Errorf("failed to update next run time: %v", err)
+		}
+		return nil
+	}
+
+	// One-shot jobs are finished once started, and @reboot jobs have no
+	// next run until the daemon restarts. Everything else follows on from
+	// the run that was just due, not from when it happened to be launched.
+	nextRun := plan.Next
+
+	var nextRunUnix int64
+	if !nextRun.IsZero() {
+		nextRunUnix = nextRun.Unix()
+	}
+
+	// Update the database
+	_, err := d.db.Exec(
+		"UPDATE jobs SET next_run = ? WHERE id = ?",
+		nextRunUnix,
+		job.ID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update next run time: %v", err)
+	}
+
+	if parsed.AtReboot {
+		d.logger.Printf("Job %d will run again on next daemon start", job.ID)
+		return nil
+	}
+	if nextRun.IsZero() {
+		d.logger.Printf("Job %d has no further runs scheduled", job.ID)
+		return nil
+	}
+
+	d.logger.Printf("Updated job %d next run time to %s", job.ID, nextRun.Format(logTimeFormat))
+	return nil
+}
+
+// scheduleRetry sets when the next attempt of a failed run is due, backing
+// off according to the job's retry policy. The poll loop starts it.
+func (d *Daemon) scheduleRetry(job *Job, scheduled time.Time, attempt int, ended time.Time) error {
+	retryAt := ended.Add(job.Retry.NextDelay(attempt))
+	_, err := d.db.Exec(
+		"UPDATE jobs SET retry_at = ?, retry_attempt = ?, retry_scheduled = ? WHERE id = ?",
+		retryAt.Unix(),
+		attempt+1,
+		scheduled.Unix(),
+		job.ID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update retry time: %v", err)
+	}
+
+	// A fixed-delay job's next run counts from the end of its last attempt,
+	// so it has none until the retries are over
+	if parsed, err := schedule.Parse(job.Schedule); err == nil && parsed.Mode == schedule.FixedDelay {
+		if _, err := d.db.Exec("UPDATE jobs SET next_run = 0 WHERE id = ?", job.ID); err != nil {
+			return fmt.Errorf("failed to update next run time: %v", err)
+		}
+	}
+
+	d.logger.Printf("Job %d will retry at %s (attempt %d of %d)",
+		job.ID, retryAt.Format(logTimeFormat), attempt+1, job.Retry.MaxAttempts)
+	return nil
+}
+
+// scheduleAfterCompletion sets the next run of a fixed-delay job to one
+// interval after the run that just finished
+func (d *Daemon) scheduleAfterCompletion(job *Job) error {
+	if job.Schedule == "" {
+		return nil
+	}
+
+	parsed, err := schedule.Parse(job.Schedule)
+	if err != nil {
+		return fmt.Errorf("failed to parse schedule: %v", err)
+	}
+	if parsed.Mode != schedule.FixedDelay {
+		return nil
+	}
+
+	nextRun := schedule.NextRunAfter(parsed, time.Unix(job.NextRun, 0), time.Now())
+	_, err = d.db.Exec("UPDATE jobs SET next_run = ? WHERE id = ?", nextRun.Unix(), job.ID)
+	if err != nil {
+		return fmt.Errorf("failed to update next run time: %v", err)
+	}
+
+	d.logger.Printf("Updated job %d next run time to %s", job.ID, nextRun.Format(logTimeFormat))
+	return nil
+}
+
+// reload reads the run-as policy and API tokens again and checks for due
+// jobs, so changes to any of them take effect now
+func (d *Daemon) reload() error {
+	runAs, err := runner.LoadRunAsPolicy(d.runAsPath)
+	if err != nil {
+		return fmt.Errorf("failed to read run-as policy: %v", err)
+	}
+	var tokens *api.Tokens
+	if d.tokensPath != "" {
+		if tokens, err = api.LoadTokens(d.tokensPath); err != nil {
+			return fmt.Errorf("failed to read API tokens: %v", err)
+		}
+	}
+	d.jobsMutex.Lock()
+	d.runAs = runAs
+	if tokens != nil {
+		d.tokens = tokens
+	}
+	d.jobsMutex.Unlock()
+
+	d.logger.Println("Reloaded run-as policy and API tokens")
+	d.wakeUp()
+	return nil
+}
+
+// apiHandler routes the control API
+func (d *Daemon) apiHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET "+api.Path("/status"), d.handleStatus)
+	mux.HandleFunc("GET "+api.Path("/jobs"), d.handleListJobs)
+	mux.HandleFunc("POST "+api.Path("/jobs"), d.handleAddJob)
+	mux.HandleFunc("GET "+api.Path("/jobs/{id}"), d.handleGetJob)
+	mux.HandleFunc("PUT "+api.Path("/jobs/{id}"), d.handleUpdateJob)
+	mux.HandleFunc("DELETE "+api.Path("/jobs/{id}"), d.handleDeleteJob)
+	mux.HandleFunc("POST "+api.Path("/jobs/{id}/run"), d.handleRunJob)
+	mux.HandleFunc("POST "+api.Path("/jobs/{id}/pause"), d.handlePauseJob(true))
+	mux.HandleFunc("POST "+api.Path("/jobs/{id}/resume"), d.handlePauseJob(false))
+	mux.HandleFunc("GET "+api.Path("/jobs/{id}/runs"), d.handleJobRuns)
+	mux.HandleFunc("GET "+api.Path("/runs/{id}/log"), d.handleRunLog)
+	mux.HandleFunc("POST "+api.Path("/runs/{id}/kill"), d.handleKillRun)
+	mux.HandleFunc("POST "+api.Path("/reload"), d.handleReload)
+	mux.HandleFunc("GET "+api.Path(api.OpenAPIPath), func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/yaml")
+		w.Write(api.OpenAPI)
+	})
+	return mux
+}
+
+// authenticate passes on requests to h that bear one of the API tokens
+// antd has loaded, as the token's user
+func (d *Daemon) authenticate(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		d.jobsMutex.Lock()
+		tokens := d.tokens
+		d.jobsMutex.Unlock()
+		tokens.Authenticate(h).ServeHTTP(w, r)
+	})
+}
+
+func (d *Daemon) handleStatus(w http.ResponseWriter, r *http.Request) {
+	d.jobsMutex.Lock()
+	running := 0
+	for _, runs := range d.running {
+		running += len(runs)
+	}
+	d.jobsMutex.Unlock()
+
+	api.WriteJSON(w, http.StatusOK, api.Status{
+		Version:  api.Version,
+		PID:      os.Getpid(),
+		Database: d.dbPath,
+		Running:  running,
+	})
+}
+
+// handleListJobs lists the jobs the caller may act on, which for root is
+// every job
+func (d *Daemon) handleListJobs(w http.ResponseWriter, r *http.Request) {
+	if _, err := api.Caller(r); err != nil {
+		api.WriteError(w, http.StatusForbidden, err)
+		return
+	}
+	all, err := store.ListJobs(d.db)
+	if err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	jobs := []store.JobStatus{}
+	for _, job := range all {
+		if api.Authorize(r, job.SubmittedUID) == nil {
+			jobs = append(jobs, job)
+		}
+	}
+	api.WriteJSON(w, http.StatusOK, jobs)
+}
+
+// jobRequest is a job to add or update, as read from a request
+type jobRequest struct {
+	spec      api.JobSpec
+	opts      store.JobOptions
+	nextRun   time.Time
+	submitter store.Submitter
+}
+
+// readJob reads and checks the job in a request's body on behalf of the
+// user calling, who it then runs as unless it names another user. It
+// writes an error response and returns false if the job won't do.
+func (d *Daemon) readJob(w http.ResponseWriter, r *http.Request) (jobRequest, bool) {
+	var req jobRequest
+	caller, err := api.Caller(r)
+	if err != nil {
+		api.WriteError(w, http.StatusForbidden, err)
+		return req, false
+	}
+	if err := api.ReadJSON(r, &req.spec); err != nil {
+		api.WriteError(w, http.StatusBadRequest, err)
+		return req, false
+	}
+	req.opts, err = req.spec.Options()
+	if err == nil && strings.TrimSpace(req.spec.Command) == "" {
+		err = fmt.Errorf("a job needs a command")
+	}
+	if err != nil {
+		api.WriteError(w, http.StatusBadRequest, err)
+		return req, false
+	}
+
+	// Watch loops start at once; everything else follows its schedule
+	now := time.Now()
+	req.nextRun = now
+	if req.spec.Schedule != "" {
+		parsed, err := schedule.Parse(req.spec.Schedule)
+		if err != nil {
+			api.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid schedule: %v", err))
+			return req, false
+		}
+		req.nextRun = schedule.CalculateNextRun(parsed, now)
+		if !parsed.At.IsZero() && req.nextRun.Before(now) {
+			api.WriteError(w, http.StatusBadRequest, fmt.Errorf("%s is in the past", req.nextRun.Format(logTimeFormat)))
+			return req, false
+		}
+	}
+
+	// Refuse a user the policy won't run the job as now, rather than at
+	// each run
+	if req.opts.User != "" || req.opts.Group != "" {
+		name := req.opts.User
+		if name == "" {
+			name = caller.Uid
+		}
+		id, err := runner.LookupIdentity(name, req.opts.Group)
+		if err == nil {
+			d.jobsMutex.Lock()
+			err = d.runAs.Allows(caller, id)
+			d.jobsMutex.Unlock()
+		}
+		if err != nil {
+			api.WriteError(w, http.StatusForbidden, err)
+			return req, false
+		}
+	}
+
+	uid, err := strconv.Atoi(caller.Uid)
+	if err != nil {
+		api.WriteError(w, http.StatusForbidden, fmt.Errorf("unexpected user ID %s", caller.Uid))
+		return req, false
+	}
+	req.submitter = store.Submitter{Name: caller.Username, UID: uid}
+	return req, true
+}
+
+func (d *Daemon) handleAddJob(w http.ResponseWriter, r *http.Request) {
+	req, ok := d.readJob(w, r)
+	if !ok {
+		return
+	}
+	jobID, err := store.AddJob(d.db, req.spec.Schedule, req.spec.Command, req.nextRun, req.opts, req.submitter)
+	if err != nil {
+		api.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	d.logger.Printf("Job %d added by %s", jobID, req.submitter.Name)
+	d.wakeUp()
+
+	var nextRunUnix int64
+	if !req.nextRun.IsZero() {
+		nextRunUnix = req.nextRun.Unix()
+	}
+	api.WriteJSON(w, http.StatusCreated, api.JobAdded{ID: jobID, NextRun: nextRunUnix})
+}
+
+func (d *Daemon) handleGetJob(w http.ResponseWriter, r *http.Request) {
+	jobID, ok := d.pathJob(w, r)
+	if !ok {
+		return
+	}
+	job, err := d.jobStatus(jobID)
+	if err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	api.WriteJSON(w, http.StatusOK, job)
+}
+
+// handleUpdateJob replaces a job's settings with those in the request, as
+// adding it anew would have set them, and returns the job
+func (d *Daemon) handleUpdateJob(w http.ResponseWriter, r *http.Request) {
+	jobID, ok := d.pathJob(w, r)
+	if !ok {
+		return
+	}
+	req, ok := d.readJob(w, r)
+	if !ok {
+		return
+	}
+	d.jobsMutex.Lock()
+	err := store.UpdateJob(d.db, jobID, req.spec.Schedule, req.spec.Command, req.nextRun, req.opts, req.submitter)
+	d.jobsMutex.Unlock()
+	if err != nil {
+		api.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	d.logger.Printf("Job %d updated by %s", jobID, req.submitter.Name)
+	d.wakeUp()
+
+	job, err := d.jobStatus(jobID)
+	if err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	api.WriteJSON(w, http.StatusOK, job)
+}
+
+// handlePauseJob returns a handler that pauses a job, or resumes it.
+// Pausing leaves runs already going alone.
+func (d *Daemon) handlePauseJob(paused bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		jobID, ok := d.pathJob(w, r)
+		if !ok {
+			return
+		}
+		d.jobsMutex.Lock()
+		err := store.SetPaused(d.db, jobID, paused)
+		d.jobsMutex.Unlock()
+		if err != nil {
+			api.WriteError(w, http.StatusInternalServerError, err)
+			return
+		}
+		if paused {
+			d.logger.Printf("Job %d paused", jobID)
+		} else {
+			d.logger.Printf("Job %d resumed", jobID)
+			d.wakeUp()
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// jobStatus returns one job as GET /jobs lists it
+func (d *Daemon) jobStatus(jobID int) (store.JobStatus, error) {
+	jobs, err := store.ListJobs(d.db)
+	if err != nil {
+		return store.JobStatus{}, err
+	}
+	for _, job := range jobs {
+		if job.ID == jobID {
+			return job, nil
+		}
+	}
+	return store.JobStatus{}, fmt.Errorf("job %d not found", jobID)
+}
+
+// handleDeleteJob stops a job's runs and removes it
+func (d *Daemon) handleDeleteJob(w http.ResponseWriter, r *http.Request) {
+	jobID, ok := d.pathJob(w, r)
+	if !ok {
+		return
+	}
+
+	// Take the job out of scheduling, so nothing new starts while its runs
+	// are stopped, and make sure the runs this daemon started aren't retried
+	d.jobsMutex.Lock()
+	var paused bool
+	var killGraceMs int64
+	err := d.db.QueryRow("SELECT paused, kill_grace_ms FROM jobs WHERE id = ?", jobID).Scan(&paused, &killGraceMs)
+	if err == nil {
+		_, err = d.db.Exec("UPDATE jobs SET paused = 1 WHERE id = ?", jobID)
+	}
+	var groups []int
+	if err == nil {
+		groups, err = store.RunningGroups(d.db, jobID)
+	}
+	for _, run := range d.running[jobID] {
+		run.killed = true
+	}
+	d.jobsMutex.Unlock()
+	if err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	grace := time.Duration(killGraceMs) * time.Millisecond
+	for _, pgid := range groups {
+		if err := runner.StopGroup(pgid, grace); err != nil {
+			// Keep the job as it was, for the caller to try again
+			if _, err := d.db.Exec("UPDATE jobs SET paused = ? WHERE id = ?", paused, jobID); err != nil {
+				d.logger.Printf("Error restoring job %d: %v", jobID, err)
+			}
+			api.WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to stop job %d: %v", jobID, err))
+			return
+		}
+	}
+
+	d.jobsMutex.Lock()
+	err = store.DeleteJob(d.db, jobID)
+	d.jobsMutex.Unlock()
+	if err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	d.logger.Printf("Job %d deleted", jobID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleRunJob queues a run of a job, which starts as soon as its overlap
+// policy and the concurrency limits allow
+func (d *Daemon) handleRunJob(w http.ResponseWriter, r *http.Request) {
+	jobID, ok := d.pathJob(w, r)
+	if !ok {
+		return
+	}
+	var paused bool
+	if err := d.db.QueryRow("SELECT paused FROM jobs WHERE id = ?", jobID).Scan(&paused); err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if paused {
+		api.WriteError(w, http.StatusConflict, fmt.Errorf("job %d is paused", jobID))
+		return
+	}
+	note := "run on request"
+	if caller, err := api.Caller(r); err == nil {
+		note = "run by " + caller.Username
+	}
+
+	d.jobsMutex.Lock()
+	runID, err := d.recordQueued(jobID, pendingRun{scheduled: time.Now(), attempt: 1}, note)
+	d.jobsMutex.Unlock()
+	if err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	d.logger.Printf("Job %d queued to run now (run %d)", jobID, runID)
+	d.wakeUp()
+	api.WriteJSON(w, http.StatusAccepted, api.RunQueued{RunID: runID})
+}
+
+// handleJobRuns returns a job's most recent runs, 20 unless the limit
+// parameter says otherwise
+func (d *Daemon) handleJobRuns(w http.ResponseWriter, r *http.Request) {
+	jobID, ok := d.pathJob(w, r)
+	if !ok {
+		return
+	}
+	var err error
+	limit := 20
+	if value := r.URL.Query().Get("limit"); value != "" {
+		if limit, err = strconv.Atoi(value); err != nil || limit <= 0 {
+			api.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid limit: %s", value))
+			return
+		}
+	}
+
+	runs, err := store.History(d.db, jobID, limit)
+	if err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	api.WriteJSON(w, http.StatusOK, runs)
+}
+
+// handleKillRun stops a running run the way a timeout does, or cancels a
+// queued one. Either way it is not retried.
+func (d *Daemon) handleKillRun(w http.ResponseWriter, r *http.Request) {
+	runID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		api.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid run ID: %s", r.PathValue("id")))
+		return
+	}
+
+	d.jobsMutex.Lock()
+	var jobID, pid, owner int
+	var status string
+	var killGraceMs int64
+	// The run of a deleted job is root's to stop
+	err = d.db.QueryRow(`
+		SELECT r.job_id, COALESCE(r.pid, 0), r.status, COALESCE(j.kill_grace_ms, 0), COALESCE(j.submitted_uid, 0)
+		FROM job_runs r LEFT JOIN jobs j ON j.id = r.job_id
+		WHERE r.id = ?`, runID).Scan(&jobID, &pid, &status, &killGraceMs, &owner)
+	if err != nil {
+		d.jobsMutex.Unlock()
+		if err == sql.ErrNoRows {
+			api.WriteError(w, http.StatusNotFound, fmt.Errorf("run %d not found", runID))
+			return
+		}
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if err := api.Authorize(r, owner); err != nil {
+		d.jobsMutex.Unlock()
+		api.WriteError(w, http.StatusForbidden, err)
+		return
+	}
+
+	switch {
+	case status == "queued":
+		_, err = d.db.Exec(
+			"UPDATE job_runs SET status = 'killed', end_time = ?, note = 'cancelled before it started' WHERE id = ?",
+			time.Now().Unix(),
+			runID,
+		)
+		d.jobsMutex.Unlock()
+		if err != nil {
+			api.WriteError(w, http.StatusInternalServerError, err)
+			return
+		}
+		d.logger.Printf("Cancelled queued run %d of job %d", runID, jobID)
+		w.WriteHeader(http.StatusNoContent)
+		return
+
+	case status != "running" || pid <= 0:
+		d.jobsMutex.Unlock()
+		api.WriteError(w, http.StatusConflict, fmt.Errorf("run %d is not running (%s)", runID, status))
+		return
+	}
+
+	// A run started by an earlier antd has no one to record its end
+	var active *activeRun
+	for _, run := range d.running[jobID] {
+		if run.runID == runID {
+			active = run
+			active.killed = true
+		}
+	}
+	d.jobsMutex.Unlock()
+
+	d.logger.Printf("Stopping run %d of job %d", runID, jobID)
+	if err := runner.StopGroup(pid, time.Duration(killGraceMs)*time.Millisecond); err != nil {
+		api.WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to stop run %d: %v", runID, err))
+		return
+	}
+	if active == nil {
+		_, err := d.db.Exec("UPDATE job_runs SET status = 'killed', end_time = ? WHERE id = ?", time.Now().Unix(), runID)
+		if err != nil {
+			api.WriteError(w, http.StatusInternalServerError, err)
+			return
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleRunLog writes a run's output as plain text. The stream parameter
+// picks stdout or stderr of a run that kept them apart, lines only the
+// last that many lines of each log and since only tagged lines written from
+// then on. With follow, it carries on writing output as the run writes it
+// until the run is over.
+func (d *Daemon) handleRunLog(w http.ResponseWriter, r *http.Request) {
+	runID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		api.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid run ID: %s", r.PathValue("id")))
+		return
+	}
+	query := r.URL.Query()
+	stream := query.Get("stream")
+	if stream != "" && stream != logs.Stdout && stream != logs.Stderr {
+		api.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid stream: %s (want %s or %s)", stream, logs.Stdout, logs.Stderr))
+		return
+	}
+	lines := 0
+	if value := query.Get("lines"); value != "" {
+		if lines, err = strconv.Atoi(value); err != nil || lines <= 0 {
+			api.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid lines: %s", value))
+			return
+		}
+	}
+	var since time.Time
+	if value := query.Get("since"); value != "" {
+		unix, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || unix <= 0 {
+			api.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid since: %s", value))
+			return
+		}
+		since = time.Unix(unix, 0)
+	}
+	follow := false
+	if value := query.Get("follow"); value != "" {
+		if follow, err = strconv.ParseBool(value); err != nil {
+			api.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid follow: %s", value))
+			return
+		}
+	}
+
+	// antd can read every log, so callers only get their own jobs' logs.
+	// Those of a deleted job are root's.
+	var jobID, owner int
+	var output string
+	err = d.db.QueryRow(`
+		SELECT r.job_id, r.output, COALESCE(j.submitted_uid, 0)
+		FROM job_runs r LEFT JOIN jobs j ON j.id = r.job_id
+		WHERE r.id = ?`, runID).Scan(&jobID, &output, &owner)
+	if err == sql.ErrNoRows {
+		api.WriteError(w, http.StatusNotFound, fmt.Errorf("run %d not found", runID))
+		return
+	}
+	if err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if err := api.Authorize(r, owner); err != nil {
+		api.WriteError(w, http.StatusForbidden, err)
+		return
+	}
+	all, err := logs.Runs(d.logDir, jobID)
+	if err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	// A separate run has a log for each stream; the others have one log
+	// with both, which only tagged lines let us split
+	var files []logs.Run
+	for _, file := range all {
+		if file.ID != runID {
+			continue
+		}
+		if output == logs.Separate && stream != "" && (file.Stream == logs.Stderr) != (stream == logs.Stderr) {
+			continue
+		}
+		files = append(files, file)
+	}
+	if len(files) == 0 {
+		api.WriteError(w, http.StatusNotFound, fmt.Errorf("no log recorded for run %d", runID))
+		return
+	}
+	var keep func(string) bool
+	if output == logs.Tagged && (stream != "" || !since.IsZero()) {
+		keep = logs.Filter{Stream: stream, Since: since}.Keep
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	offsets := make([]int64, len(files))
+	for i, file := range files {
+		if offsets[i], err = logs.Tail(w, file, lines, keep); err != nil {
+			d.logger.Printf("Error reading log of run %d: %v", runID, err)
+			return
+		}
+	}
+	if follow {
+		d.followRun(w, r, runID, files, offsets, keep)
+	}
+}
+
+// followRun writes what a run adds to its logs from offsets on, until the
+// run is over, the caller goes or antd stops
+func (d *Daemon) followRun(w http.ResponseWriter, r *http.Request, runID int64, files []logs.Run, offsets []int64, keep func(string) bool) {
+	var followers []*logs.Follower
+	defer func() {
+		for _, f := range followers {
+			f.Close()
+		}
+	}()
+	for i, file := range files {
+		// A compressed log belongs to a run that is over
+		if strings.HasSuffix(file.Path, ".gz") {
+			continue
+		}
+		f, err := logs.Follow(file.Path, offsets[i])
+		if err != nil {
+			d.logger.Printf("Error following log of run %d: %v", runID, err)
+			return
+		}
+		f.Keep = keep
+		followers = append(followers, f)
+	}
+
+	flusher, _ := w.(http.Flusher)
+	ticker := time.NewTicker(followInterval)
+	defer ticker.Stop()
+	for {
+		// Read the status first, so output written just before the run
+		// ended is still passed on
+		var status string
+		err := d.db.QueryRow("SELECT status FROM job_runs WHERE id = ?", runID).Scan(&status)
+		if err != nil && err != sql.ErrNoRows {
+			d.logger.Printf("Error following log of run %d: %v", runID, err)
+			return
+		}
+		for _, f := range followers {
+			if err := f.Poll(w); err != nil {
+				d.logger.Printf("Error following log of run %d: %v", runID, err)
+				return
+			}
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		if status != "running" && status != "queued" {
+			return
+		}
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-d.stopChan:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// handleReload reloads antd for root or the user antd runs as
+func (d *Daemon) handleReload(w http.ResponseWriter, r *http.Request) {
+	if err := api.Authorize(r, os.Getuid()); err != nil {
+		api.WriteError(w, http.StatusForbidden, fmt.Errorf("only root and antd's own user may reload it"))
+		return
+	}
+	if err := d.reload(); err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// pathJob reads the job ID in a request's path, writing an error response
+// and returning false if it is invalid, there is no such job or the caller
+// may not act on it
+func (d *Daemon) pathJob(w http.ResponseWriter, r *http.Request) (int, bool) {
+	jobID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		api.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid job ID: %s", r.PathValue("id")))
+		return 0, false
+	}
+	var owner int
+	err = d.db.QueryRow("SELECT submitted_uid FROM jobs WHERE id = ?", jobID).Scan(&owner)
+	if err == sql.ErrNoRows {
+		api.WriteError(w, http.StatusNotFound, fmt.Errorf("job %d not found", jobID))
+		return 0, false
+	}
+	if err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err)
+		return 0, false
+	}
+	if err := api.Authorize(r, owner); err != nil {
+		api.WriteError(w, http.StatusForbidden, err)
+		return 0, false
+	}
+	return jobID, true
+}
+
+func main() {
+	// Set up logging to work with systemd
+	logger := log.New(os.Stdout, "", log.LstdFlags)
+	
+	dbFlag := flag.String("db", "", "path to the job database (default $ANT_DB, then the data directory)")
+	systemFlag := flag.Bool("system", false, "use the system-wide database in "+store.SystemDir)
+	maxJobs := flag.Int("max-jobs", 0, "runs allowed at once across all jobs (default no limit)")
+	pools := make(map[string]int)
+	flag.Func("pool", "limit a concurrency pool as name=N; may be repeated", func(value string) error {
+		name, limit, ok := strings.Cut(value, "=")
+		n, err := strconv.Atoi(limit)
+		if !ok || name == "" || err != nil || n < 1 {
+			return fmt.Errorf("want name=N with N at least 1")
+		}
+		pools[name] = n
+		return nil
+	})
+	runAsFlag := flag.String("run-as-policy", "", "file of rules allowing users to run jobs as other users")
+	var logPolicy logs.Policy
+	logMaxSize := flag.String("log-max-size", "10M", "rotate a running job's log once it grows past this size, 0 for never")
+	flag.IntVar(&logPolicy.Segments, "log-segments", 5, "rotated pieces of a running job's log to keep")
+	flag.DurationVar(&logPolicy.MaxAge, "log-max-age", 0, "remove logs of runs that finished longer ago than this (default never)")
+	flag.IntVar(&logPolicy.Keep, "log-keep", 20, "logs of finished runs to keep per job, 0 for all; ant --log-keep overrides it")
+	flag.BoolVar(&logPolicy.Compress, "log-compress", false, "gzip the logs of finished runs and rotated pieces")
+	cgroupFlag := flag.String("cgroup", "auto", "cgroup v2 subtree to run jobs in: auto for antd's own, a path, or off")
+	socketFlag := flag.String("socket", "", "Unix socket to serve the control API on, or off (default next to the database)")
+	socketGroup := flag.String("socket-group", "", "group whose members may use the control API as well as antd's user")
+	httpFlag := flag.String("http", "", "localhost address to serve the API on to token holders, such as 127.0.0.1:8321 (default off)")
+	tokensFlag := flag.String("http-tokens", "", "file of user: token lines the --http listener accepts")
+	flag.Parse()
+
+	maxSize, err := runner.ParseBytes(*logMaxSize)
+	if err != nil {
+		logger.Fatal("Invalid --log-max-size:", err)
+	}
+	logPolicy.MaxSize = maxSize
+
+	// Resolve the database the same way ant does; root is always system-wide
+	dbPath, err := store.Path(*dbFlag, *systemFlag || os.Geteuid() == 0)
+	if err != nil {
+		logger.Fatal("Failed to locate database:", err)
+	}
+	logger.Printf("Using database %s", dbPath)
+
+	// Open database connection, migrating the schema if ant hasn't yet
+	db, err := store.Open(dbPath)
+	if err != nil {
+		logger.Fatal("Failed to open database:", err)
+	}
+	defer db.Close()
+
+	runAs, err := runner.LoadRunAsPolicy(*runAsFlag)
+	if err != nil {
+		logger.Fatal("Failed to read run-as policy:", err)
+	}
+
+	// Send startup notification to systemd
+	if os.Getenv("NOTIFY_SOCKET") != "" {
+		daemon.SdNotify(false, daemon.SdNotifyReady)
+	}
+
+	// Create and start the daemon
+	d := NewDaemon(db, dbPath)
+	
+	// Update logger to use systemd's stdout
+	d.logger = logger
+	d.maxJobs = *maxJobs
+	d.pools = pools
+	d.runAs = runAs
+	d.runAsPath = *runAsFlag
+	d.logPolicy = logPolicy
+	logger.Printf("Writing job logs to %s", d.logDir)
+
+	// Run jobs in cgroups if they have been delegated to us
+	if *cgroupFlag != "off" {
+		root := *cgroupFlag
+		if root == "auto" {
+			root = ""
+		}
+		if d.cgroups, err = runner.OpenCgroups(root); err != nil {
+			logger.Printf("Running jobs without resource limits: %v", err)
+		} else {
+			logger.Printf("Running jobs in cgroup %s", d.cgroups.Root())
+		}
+	}
+	
+	// Serve the control API, which is how ant reaches the daemon
+	if *socketFlag != "off" {
+		socketPath := *socketFlag
+		if socketPath == "" {
+			socketPath = api.SocketPath(dbPath)
+		}
+		if d.listener, err = api.Listen(socketPath, *socketGroup); err != nil {
+			logger.Fatal("Failed to listen on control socket:", err)
+		}
+		logger.Printf("Serving control API on %s", socketPath)
+	}
+
+	// Serve it to token holders on a localhost port too, if asked
+	if *httpFlag != "" {
+		if *tokensFlag == "" {
+			logger.Fatal("--http needs --http-tokens")
+		}
+		if d.tokens, err = api.LoadTokens(*tokensFlag); err != nil {
+			logger.Fatal("Failed to read API tokens:", err)
+		}
+		d.tokensPath = *tokensFlag
+		if d.httpListener, err = api.ListenHTTP(*httpFlag); err != nil {
+			logger.Fatal("Failed to listen for HTTP API:", err)
+		}
+		logger.Printf("Serving HTTP API on %s", d.httpListener.Addr())
+	}
+
+	// Start the daemon
+	d.Start()
+
+	// Notify systemd of clean shutdown
+	if os.Getenv("NOTIFY_SOCKET") != "" {
+		daemon.SdNotify(false, daemon.SdNotifyStopping)
+	}
 }
\ No newline at end of file
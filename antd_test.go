@@ -0,0 +1,305 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/user"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gagehenrich/ant/api"
+	"github.com/gagehenrich/ant/logs"
+	"github.com/gagehenrich/ant/runner"
+	"github.com/gagehenrich/ant/store"
+)
+
+// Tokens of the users testDaemon's API accepts
+const (
+	rootToken   = "rrrrrrrrrrrrrrrr"
+	nobodyToken = "nnnnnnnnnnnnnnnn"
+)
+
+// newDaemon returns a daemon on a new database, with nothing running
+func newDaemon(t *testing.T) *Daemon {
+	t.Helper()
+	dbPath := filepath.Join(t.TempDir(), "ant.db3")
+	db, err := store.Open(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	return &Daemon{
+		db:       db,
+		dbPath:   dbPath,
+		logDir:   logs.Dir(dbPath),
+		logger:   log.New(io.Discard, "", 0),
+		stopChan: make(chan struct{}),
+		running:  make(map[int][]*activeRun),
+		wake:     make(chan struct{}, 1),
+	}
+}
+
+// testDaemon returns a new daemon serving its API to root and nobody with
+// rootToken and nobodyToken, and nobody's user ID
+func testDaemon(t *testing.T) (*Daemon, int) {
+	t.Helper()
+	nobody, err := user.Lookup("nobody")
+	if err != nil {
+		t.Skip("no nobody user to hold the other token")
+	}
+	nobodyUID, _ := strconv.Atoi(nobody.Uid)
+
+	d := newDaemon(t)
+	d.tokensPath = filepath.Join(t.TempDir(), "tokens")
+	if err := os.WriteFile(d.tokensPath, []byte("root: "+rootToken+"\nnobody: "+nobodyToken+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if d.tokens, err = api.LoadTokens(d.tokensPath); err != nil {
+		t.Fatal(err)
+	}
+	return d, nobodyUID
+}
+
+// addJob adds a manual job submitted by the user with ID uid
+func addJob(t *testing.T, d *Daemon, uid int) int {
+	t.Helper()
+	id, err := store.AddJob(d.db, "@manual", "true", time.Time{}, store.JobOptions{MaxParallel: 1}, store.Submitter{UID: uid})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return int(id)
+}
+
+// addRun records a run of a job with the given status, its output
+// combined in one log
+func addRun(t *testing.T, d *Daemon, jobID int, status string) int64 {
+	t.Helper()
+	res, err := d.db.Exec("INSERT INTO job_runs (job_id, start_time, status, output) VALUES (?, ?, ?, ?)",
+		jobID, time.Now().Unix(), status, logs.Combined)
+	if err != nil {
+		t.Fatal(err)
+	}
+	runID, _ := res.LastInsertId()
+	return runID
+}
+
+// call makes a request of the daemon's API with a token, the way its
+// localhost port would serve it
+func call(d *Daemon, method, path, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, api.Path(path), nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	d.authenticate(d.apiHandler()).ServeHTTP(rec, req)
+	return rec
+}
+
+// listJobs returns the IDs of the jobs GET /jobs shows the token's user
+func listJobs(t *testing.T, d *Daemon, token string) []int {
+	t.Helper()
+	rec := call(d, http.MethodGet, "/jobs", token)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /jobs = %d %s", rec.Code, rec.Body)
+	}
+	var jobs []store.JobStatus
+	if err := json.NewDecoder(rec.Body).Decode(&jobs); err != nil {
+		t.Fatal(err)
+	}
+	ids := []int{}
+	for _, job := range jobs {
+		ids = append(ids, job.ID)
+	}
+	return ids
+}
+
+func TestListJobsOwnership(t *testing.T) {
+	d, nobody := testDaemon(t)
+	rootJob := addJob(t, d, 0)
+	nobodyJob := addJob(t, d, nobody)
+
+	if got, want := listJobs(t, d, nobodyToken), []int{nobodyJob}; !reflect.DeepEqual(got, want) {
+		t.Errorf("jobs listed for nobody = %v, want %v", got, want)
+	}
+	if got, want := listJobs(t, d, rootToken), []int{rootJob, nobodyJob}; !reflect.DeepEqual(got, want) {
+		t.Errorf("jobs listed for root = %v, want %v", got, want)
+	}
+}
+
+// writeRunLog writes a run's log
+func writeRunLog(t *testing.T, d *Daemon, jobID int, runID int64, content string) {
+	t.Helper()
+	f, err := logs.Create(d.logDir, jobID, runID, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(content); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOwnership(t *testing.T) {
+	d, nobody := testDaemon(t)
+	rootJob := addJob(t, d, 0)
+	rootRun := addRun(t, d, rootJob, "queued")
+	writeRunLog(t, d, rootJob, rootRun, "root's output\n")
+	nobodyJob := addJob(t, d, nobody)
+	nobodyRun := addRun(t, d, nobodyJob, "queued")
+	writeRunLog(t, d, nobodyJob, nobodyRun, "nobody's output\n")
+
+	// nobody may not touch root's job or its runs
+	for _, tc := range []struct {
+		method, path string
+	}{
+		{http.MethodGet, fmt.Sprintf("/jobs/%d", rootJob)},
+		{http.MethodPut, fmt.Sprintf("/jobs/%d", rootJob)},
+		{http.MethodDelete, fmt.Sprintf("/jobs/%d", rootJob)},
+		{http.MethodPost, fmt.Sprintf("/jobs/%d/run", rootJob)},
+		{http.MethodPost, fmt.Sprintf("/jobs/%d/pause", rootJob)},
+		{http.MethodPost, fmt.Sprintf("/jobs/%d/resume", rootJob)},
+		{http.MethodGet, fmt.Sprintf("/jobs/%d/runs", rootJob)},
+		{http.MethodGet, fmt.Sprintf("/runs/%d/log", rootRun)},
+		{http.MethodPost, fmt.Sprintf("/runs/%d/kill", rootRun)},
+	} {
+		if rec := call(d, tc.method, tc.path, nobodyToken); rec.Code != http.StatusForbidden {
+			t.Errorf("%s %s as nobody = %d %s, want %d", tc.method, tc.path, rec.Code, rec.Body, http.StatusForbidden)
+		}
+	}
+	var status string
+	var paused bool
+	err := d.db.QueryRow("SELECT r.status, j.paused FROM job_runs r JOIN jobs j ON j.id = r.job_id WHERE r.id = ?", rootRun).
+		Scan(&status, &paused)
+	if err != nil || status != "queued" || paused {
+		t.Errorf("root's run = %s, paused %v, %v; want it queued and the job as it was", status, paused, err)
+	}
+	if got, want := listJobs(t, d, nobodyToken), []int{nobodyJob}; !reflect.DeepEqual(got, want) {
+		t.Errorf("jobs listed for nobody = %v, want %v", got, want)
+	}
+
+	// nobody may act on their own job, and root on anyone's
+	for _, tc := range []struct {
+		method, path, token string
+		code                int
+		body                string
+	}{
+		{http.MethodGet, fmt.Sprintf("/jobs/%d", nobodyJob), nobodyToken, http.StatusOK, ""},
+		{http.MethodGet, fmt.Sprintf("/runs/%d/log", nobodyRun), nobodyToken, http.StatusOK, "nobody's output\n"},
+		{http.MethodGet, fmt.Sprintf("/runs/%d/log", nobodyRun), rootToken, http.StatusOK, "nobody's output\n"},
+		{http.MethodGet, fmt.Sprintf("/runs/%d/log", rootRun), rootToken, http.StatusOK, "root's output\n"},
+		{http.MethodPost, fmt.Sprintf("/runs/%d/kill", nobodyRun), nobodyToken, http.StatusNoContent, ""},
+		{http.MethodPost, fmt.Sprintf("/runs/%d/kill", rootRun), rootToken, http.StatusNoContent, ""},
+	} {
+		rec := call(d, tc.method, tc.path, tc.token)
+		if rec.Code != tc.code || (tc.body != "" && rec.Body.String() != tc.body) {
+			t.Errorf("%s %s = %d %q, want %d %q", tc.method, tc.path, rec.Code, rec.Body, tc.code, tc.body)
+		}
+	}
+}
+
+func TestFollowRunLog(t *testing.T) {
+	d, _ := testDaemon(t)
+	jobID := addJob(t, d, 0)
+	runID := addRun(t, d, jobID, "running")
+	f, err := logs.Create(d.logDir, jobID, runID, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	f.WriteString("first\n")
+
+	server := httptest.NewServer(d.authenticate(d.apiHandler()))
+	defer server.Close()
+	req, _ := http.NewRequest(http.MethodGet, server.URL+api.Path(fmt.Sprintf("/runs/%d/log?follow=true", runID)), nil)
+	req.Header.Set("Authorization", "Bearer "+rootToken)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	// What the run writes later is passed on, and the response ends with it
+	read := bufio.NewReader(resp.Body)
+	if line, err := read.ReadString('\n'); line != "first\n" {
+		t.Fatalf("first line = %q, %v", line, err)
+	}
+	f.WriteString("second\n")
+	if _, err := d.db.Exec("UPDATE job_runs SET status = 'ok' WHERE id = ?", runID); err != nil {
+		t.Fatal(err)
+	}
+	rest, err := io.ReadAll(read)
+	if err != nil || string(rest) != "second\n" {
+		t.Errorf("rest of the log = %q, %v, want %q", rest, err, "second\n")
+	}
+}
+
+func TestAdmitQueuedForSlot(t *testing.T) {
+	d := newDaemon(t)
+	scheduled := time.Now()
+
+	// A run waiting for a free slot holds up the next one, unless the job
+	// allows its runs to overlap: then the next one waits behind it
+	for _, tc := range []struct {
+		overlap runner.Overlap
+		running int
+		status  string
+	}{
+		{runner.Forbid, 0, "skipped"},
+		{runner.Queue, 0, "skipped"},
+		{runner.Allow, 0, "queued"},
+		{runner.Allow, 1, "skipped"}, // runs going still count against max-parallel
+	} {
+		jobID := addJob(t, d, 0)
+		addRun(t, d, jobID, "queued")
+		d.running[jobID] = nil
+		for i := 0; i < tc.running; i++ {
+			d.running[jobID] = append(d.running[jobID], &activeRun{pid: 1})
+		}
+		job := &Job{ID: jobID, Overlap: tc.overlap, MaxParallel: 1, QueuedCount: 1}
+		if d.admit(job, scheduled) {
+			t.Errorf("admit with overlap=%s, %d running and a run queued = true, want false", tc.overlap, tc.running)
+		}
+
+		var status string
+		if err := d.db.QueryRow("SELECT status FROM job_runs WHERE job_id = ? ORDER BY id DESC", jobID).Scan(&status); err != nil {
+			t.Fatal(err)
+		}
+		if status != tc.status {
+			t.Errorf("overlap=%s with %d running: new run %s, want %s", tc.overlap, tc.running, status, tc.status)
+		}
+	}
+}
+
+func TestScheduledRunSupersedesRetry(t *testing.T) {
+	d := newDaemon(t)
+	id, err := store.AddJob(d.db, "@hourly", "true", time.Now().Add(-time.Second), store.JobOptions{MaxParallel: 1}, store.Submitter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	jobID := int(id)
+	if _, err := d.db.Exec("UPDATE jobs SET retry_at = ?, retry_attempt = 2 WHERE id = ?", time.Now().Unix(), jobID); err != nil {
+		t.Fatal(err)
+	}
+
+	// The scheduled run is skipped since one is going, but the retry is
+	// dropped all the same rather than run on the next tick
+	d.running[jobID] = []*activeRun{{pid: 1}}
+	if err := d.checkAndExecuteJobs(); err != nil {
+		t.Fatal(err)
+	}
+	var retryAt int64
+	if err := d.db.QueryRow("SELECT retry_at FROM jobs WHERE id = ?", jobID).Scan(&retryAt); err != nil {
+		t.Fatal(err)
+	}
+	if retryAt != 0 {
+		t.Errorf("retry_at = %d after the scheduled run came due, want 0", retryAt)
+	}
+}
@@ -0,0 +1,244 @@
+// Package api is antd's control API: versioned JSON over HTTP on a Unix
+// socket, which ant uses to add, remove and run jobs and to read their
+// state. Anyone who may write to the socket may use it, so its file
+// permissions decide who that is. antd can serve the same API on a
+// localhost TCP port too, to callers bearing a token.
+package api
+
+import (
+	_ "embed"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/gagehenrich/ant/logs"
+	"github.com/gagehenrich/ant/runner"
+	"github.com/gagehenrich/ant/store"
+)
+
+// Version is the API version this build speaks. Every path starts with it,
+// so a later version can change them without breaking older clients.
+const Version = 1
+
+// prefix starts the path of every endpoint of this version
+var prefix = fmt.Sprintf("/v%d", Version)
+
+// OpenAPI is the OpenAPI document describing this version of the API,
+// served at OpenAPIPath
+//
+//go:embed openapi.yaml
+var OpenAPI []byte
+
+// OpenAPIPath is the endpoint serving the OpenAPI document
+const OpenAPIPath = "/openapi.yaml"
+
+// SocketName is the socket's file name, next to the database by default
+const SocketName = "antd.sock"
+
+// SocketPath returns where antd listens for the database at dbPath
+func SocketPath(dbPath string) string {
+	return filepath.Join(filepath.Dir(dbPath), SocketName)
+}
+
+// Status describes the daemon answering
+type Status struct {
+	Version  int    `json:"version"`  // API version
+	PID      int    `json:"pid"`      // antd's process ID
+	Database string `json:"database"` // path of the database it runs jobs from
+	Running  int    `json:"running"`  // runs going now
+}
+
+// Error is the body of every response that failed
+type Error struct {
+	Error string `json:"error"`
+}
+
+// JobSpec is a job to add. Its fields follow ant's job flags, and the
+// zero value of each takes the flag's default. Durations are written as
+// Go durations such as "90s", and memory_max as a size such as "512M".
+type JobSpec struct {
+	Schedule string `json:"schedule"` // without the colons; empty for a watch loop
+	Command  string `json:"command"`
+
+	MaxAttempts  int     `json:"max_attempts,omitempty"`
+	RetryDelay   string  `json:"retry_delay,omitempty"`
+	RetryBackoff float64 `json:"retry_backoff,omitempty"`
+	RetryJitter  float64 `json:"retry_jitter,omitempty"`
+	RetryOn      []int   `json:"retry_on,omitempty"`
+	Timeout      string  `json:"timeout,omitempty"`
+	KillGrace    string  `json:"kill_grace,omitempty"`
+
+	Overlap     string `json:"overlap,omitempty"`
+	MaxParallel int    `json:"max_parallel,omitempty"`
+	Pool        string `json:"pool,omitempty"`
+	Priority    int    `json:"priority,omitempty"`
+
+	After    []int `json:"after,omitempty"`
+	AfterAny bool  `json:"after_any,omitempty"`
+
+	CPUWeight int    `json:"cpu_weight,omitempty"`
+	CPUQuota  int    `json:"cpu_quota,omitempty"`
+	MemoryMax string `json:"memory_max,omitempty"`
+	PidsMax   int    `json:"pids_max,omitempty"`
+	IOWeight  int    `json:"io_weight,omitempty"`
+
+	User  string `json:"user,omitempty"`
+	Group string `json:"group,omitempty"`
+	Cwd   string `json:"cwd,omitempty"`   // absolute
+	Umask string `json:"umask,omitempty"` // octal
+
+	Env      []string `json:"env,omitempty"`
+	EnvFiles []string `json:"env_files,omitempty"` // absolute
+	ClearEnv bool     `json:"clear_env,omitempty"`
+
+	LogKeep int    `json:"log_keep,omitempty"`
+	Output  string `json:"output,omitempty"`
+}
+
+// NewJobSpec describes a job with the given options
+func NewJobSpec(schedule, command string, opts store.JobOptions) JobSpec {
+	spec := JobSpec{
+		Schedule:     schedule,
+		Command:      command,
+		MaxAttempts:  opts.Retry.MaxAttempts,
+		RetryDelay:   opts.Retry.Delay.String(),
+		RetryBackoff: opts.Retry.Backoff,
+		RetryJitter:  opts.Retry.Jitter,
+		RetryOn:      opts.Retry.ExitCodes,
+		Timeout:      opts.Timeout.String(),
+		KillGrace:    opts.KillGrace.String(),
+		Overlap:      opts.Overlap.String(),
+		MaxParallel:  opts.MaxParallel,
+		Pool:         opts.Pool,
+		Priority:     opts.Priority,
+		After:        opts.After,
+		AfterAny:     opts.AfterAny,
+		CPUWeight:    opts.Limits.CPUWeight,
+		CPUQuota:     opts.Limits.CPUQuota,
+		PidsMax:      opts.Limits.PidsMax,
+		IOWeight:     opts.Limits.IOWeight,
+		User:         opts.User,
+		Group:        opts.Group,
+		Cwd:          opts.Cwd,
+		Env:          opts.Env,
+		EnvFiles:     opts.EnvFiles,
+		ClearEnv:     opts.ClearEnv,
+		LogKeep:      opts.LogKeep,
+		Output:       opts.Output,
+	}
+	if opts.Limits.MemoryMax > 0 {
+		spec.MemoryMax = strconv.FormatInt(opts.Limits.MemoryMax, 10)
+	}
+	if opts.Umask >= 0 {
+		spec.Umask = fmt.Sprintf("%03o", opts.Umask)
+	}
+	return spec
+}
+
+// Options returns the job's options, filling in defaults, and checks them
+func (s JobSpec) Options() (store.JobOptions, error) {
+	opts := store.JobOptions{
+		Retry: runner.RetryPolicy{
+			MaxAttempts: s.MaxAttempts,
+			Backoff:     s.RetryBackoff,
+			Jitter:      s.RetryJitter,
+			ExitCodes:   s.RetryOn,
+		},
+		MaxParallel: s.MaxParallel,
+		Pool:        s.Pool,
+		Priority:    s.Priority,
+		After:       s.After,
+		AfterAny:    s.AfterAny,
+		Limits: runner.Limits{
+			CPUWeight: s.CPUWeight,
+			CPUQuota:  s.CPUQuota,
+			PidsMax:   s.PidsMax,
+			IOWeight:  s.IOWeight,
+		},
+		User:     s.User,
+		Group:    s.Group,
+		Cwd:      s.Cwd,
+		Umask:    -1,
+		Env:      s.Env,
+		EnvFiles: s.EnvFiles,
+		ClearEnv: s.ClearEnv,
+		LogKeep:  s.LogKeep,
+		Output:   s.Output,
+	}
+	if opts.Retry.MaxAttempts == 0 {
+		opts.Retry.MaxAttempts = 1
+	}
+	if opts.Retry.Backoff == 0 {
+		opts.Retry.Backoff = runner.DefaultBackoff
+	}
+	if opts.MaxParallel == 0 {
+		opts.MaxParallel = 1
+	}
+	if opts.Output == "" {
+		opts.Output = logs.Combined
+	}
+
+	var err error
+	durations := []struct {
+		name  string
+		value string
+		dest  *time.Duration
+		def   time.Duration
+	}{
+		{"retry_delay", s.RetryDelay, &opts.Retry.Delay, 10 * time.Second},
+		{"timeout", s.Timeout, &opts.Timeout, 0},
+		{"kill_grace", s.KillGrace, &opts.KillGrace, runner.DefaultKillGrace},
+	}
+	for _, d := range durations {
+		*d.dest = d.def
+		if d.value != "" {
+			if *d.dest, err = time.ParseDuration(d.value); err != nil {
+				return opts, fmt.Errorf("invalid %s: %s", d.name, d.value)
+			}
+		}
+	}
+
+	if s.Overlap != "" {
+		if opts.Overlap, err = runner.ParseOverlap(s.Overlap); err != nil {
+			return opts, err
+		}
+	}
+	if s.MemoryMax != "" {
+		if opts.Limits.MemoryMax, err = runner.ParseBytes(s.MemoryMax); err != nil {
+			return opts, err
+		}
+	}
+	if s.Umask != "" {
+		mask, err := strconv.ParseUint(s.Umask, 8, 32)
+		if err != nil {
+			return opts, fmt.Errorf("invalid umask: %s", s.Umask)
+		}
+		opts.Umask = int(mask)
+	}
+	if _, err := logs.ParseOutput(opts.Output); err != nil {
+		return opts, err
+	}
+
+	// antd can't tell what a relative path was relative to
+	if opts.Cwd != "" && !filepath.IsAbs(opts.Cwd) {
+		return opts, fmt.Errorf("cwd must be an absolute path: %s", opts.Cwd)
+	}
+	for _, path := range opts.EnvFiles {
+		if !filepath.IsAbs(path) {
+			return opts, fmt.Errorf("env file must be an absolute path: %s", path)
+		}
+	}
+	return opts, opts.Validate()
+}
+
+// JobAdded is the response to adding a job
+type JobAdded struct {
+	ID      int64 `json:"id"`
+	NextRun int64 `json:"next_run"` // Unix timestamp, 0 if not scheduled
+}
+
+// RunQueued is the response to running a job now
+type RunQueued struct {
+	RunID int64 `json:"run_id"` // the run's row in the job's history
+}
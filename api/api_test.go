@@ -0,0 +1,145 @@
+package api
+
+import (
+	"net/http"
+	"os"
+	"os/user"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gagehenrich/ant/runner"
+	"github.com/gagehenrich/ant/store"
+)
+
+func TestJobSpecOptions(t *testing.T) {
+	opts := store.JobOptions{
+		Retry: runner.RetryPolicy{
+			MaxAttempts: 4,
+			Delay:       30 * time.Second,
+			Backoff:     3,
+			Jitter:      0.2,
+			ExitCodes:   []int{1, 75},
+		},
+		Timeout:     10 * time.Minute,
+		KillGrace:   5 * time.Second,
+		Overlap:     runner.Allow,
+		MaxParallel: 2,
+		Pool:        "db",
+		After:       []int{1, 2},
+		AfterAny:    true,
+		Limits:      runner.Limits{CPUQuota: 150, MemoryMax: 3 << 29},
+		Cwd:         "/srv/app",
+		Umask:       027,
+		Env:         []string{"A=1"},
+		EnvFiles:    []string{"/srv/app/.env"},
+		LogKeep:     5,
+		Output:      "separate",
+	}
+	got, err := NewJobSpec("@hourly", "./sync.sh", opts).Options()
+	if err != nil {
+		t.Fatalf("Options unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(got, opts) {
+		t.Errorf("round trip = %+v, want %+v", got, opts)
+	}
+
+	// Fields left out take ant's defaults
+	got, err = JobSpec{Schedule: "@hourly", Command: "true"}.Options()
+	if err != nil {
+		t.Fatalf("Options unexpected error: %v", err)
+	}
+	if got.Retry.MaxAttempts != 1 || got.Retry.Delay != 10*time.Second || got.Retry.Backoff != runner.DefaultBackoff ||
+		got.KillGrace != runner.DefaultKillGrace || got.Overlap != runner.Forbid || got.MaxParallel != 1 ||
+		got.Umask != -1 || got.Output != "combined" {
+		t.Errorf("defaults = %+v", got)
+	}
+
+	for _, spec := range []JobSpec{
+		{RetryDelay: "soon"},
+		{Overlap: "sometimes"},
+		{MemoryMax: "lots"},
+		{Umask: "9"},
+		{Output: "split"},
+		{Cwd: "relative/dir"},
+		{EnvFiles: []string{".env"}},
+		{MaxParallel: 2},
+	} {
+		if _, err := spec.Options(); err == nil {
+			t.Errorf("Options(%+v) succeeded, want error", spec)
+		}
+	}
+}
+
+func TestClient(t *testing.T) {
+	path := filepath.Join(t.TempDir(), SocketName)
+	l, err := Listen(path, "")
+	if err != nil {
+		t.Fatalf("Listen unexpected error: %v", err)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("socket mode = %v, %v; want 0600", info.Mode().Perm(), err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET "+Path("/status"), func(w http.ResponseWriter, r *http.Request) {
+		WriteJSON(w, http.StatusOK, Status{Version: Version})
+	})
+	mux.HandleFunc("POST "+Path("/jobs"), func(w http.ResponseWriter, r *http.Request) {
+		caller, err := Caller(r)
+		if err != nil {
+			WriteError(w, http.StatusForbidden, err)
+			return
+		}
+		var spec JobSpec
+		if err := ReadJSON(r, &spec); err != nil {
+			WriteError(w, http.StatusBadRequest, err)
+			return
+		}
+		// Answer with the caller's UID for the test to check
+		uid, _ := strconv.Atoi(caller.Uid)
+		WriteJSON(w, http.StatusCreated, JobAdded{ID: int64(uid)})
+	})
+	mux.HandleFunc("POST "+Path("/jobs/{id}/run"), func(w http.ResponseWriter, r *http.Request) {
+		WriteError(w, http.StatusNotFound, os.ErrNotExist)
+	})
+	server := &http.Server{Handler: mux, ConnContext: ConnContext}
+	go server.Serve(l)
+	defer server.Close()
+
+	if _, err := Listen(path, ""); err == nil || !strings.Contains(err.Error(), "another antd") {
+		t.Errorf("second Listen = %v, want an error about another antd", err)
+	}
+
+	client, err := Dial(path)
+	if err != nil {
+		t.Fatalf("Dial unexpected error: %v", err)
+	}
+	defer client.Close()
+
+	me, err := user.Current()
+	if err != nil {
+		t.Fatal(err)
+	}
+	added, err := client.AddJob(JobSpec{Command: "abc"})
+	if err != nil {
+		t.Fatalf("AddJob unexpected error: %v", err)
+	}
+	if uid := strconv.FormatInt(added.ID, 10); uid != me.Uid {
+		t.Errorf("Caller UID = %s, want %s", uid, me.Uid)
+	}
+	if _, err := client.AddJob(JobSpec{Command: "abc"}); err != nil {
+		t.Errorf("second AddJob unexpected error: %v", err)
+	}
+
+	if _, err := client.RunJob(1); err == nil || err.Error() != os.ErrNotExist.Error() {
+		t.Errorf("RunJob error = %v, want the server's message", err)
+	}
+
+	if _, err := Dial(filepath.Join(t.TempDir(), SocketName)); err == nil {
+		t.Error("Dial with nothing listening succeeded")
+	}
+}
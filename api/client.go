@@ -0,0 +1,198 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gagehenrich/ant/store"
+)
+
+// dialTimeout is how long Dial waits for antd to answer
+const dialTimeout = 2 * time.Second
+
+// Client calls antd's API
+type Client struct {
+	http *http.Client
+	base string
+}
+
+// Dial connects to antd through the socket at path and checks that it
+// answers
+func Dial(path string) (*Client, error) {
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", path)
+		},
+	}
+	c := &Client{http: &http.Client{Transport: transport}, base: "http://antd" + prefix}
+
+	ctx, cancel := context.WithTimeout(context.Background(), dialTimeout)
+	defer cancel()
+	if err := c.do(ctx, http.MethodGet, "/status", nil, &Status{}); err != nil {
+		transport.CloseIdleConnections()
+		return nil, err
+	}
+	return c, nil
+}
+
+// Close releases the client's connections
+func (c *Client) Close() {
+	c.http.CloseIdleConnections()
+}
+
+// Status describes the daemon
+func (c *Client) Status() (Status, error) {
+	var status Status
+	err := c.do(context.Background(), http.MethodGet, "/status", nil, &status)
+	return status, err
+}
+
+// Jobs lists every job
+func (c *Client) Jobs() ([]store.JobStatus, error) {
+	var jobs []store.JobStatus
+	err := c.do(context.Background(), http.MethodGet, "/jobs", nil, &jobs)
+	return jobs, err
+}
+
+// History returns the most recent runs of a job, newest first
+func (c *Client) History(jobID, limit int) ([]store.RunRecord, error) {
+	var runs []store.RunRecord
+	path := fmt.Sprintf("/jobs/%d/runs?limit=%s", jobID, url.QueryEscape(strconv.Itoa(limit)))
+	err := c.do(context.Background(), http.MethodGet, path, nil, &runs)
+	return runs, err
+}
+
+// AddJob adds a job as the user calling
+func (c *Client) AddJob(spec JobSpec) (JobAdded, error) {
+	var added JobAdded
+	err := c.do(context.Background(), http.MethodPost, "/jobs", spec, &added)
+	return added, err
+}
+
+// DeleteJob stops a job's runs and removes it
+func (c *Client) DeleteJob(jobID int) error {
+	return c.do(context.Background(), http.MethodDelete, fmt.Sprintf("/jobs/%d", jobID), nil, nil)
+}
+
+// RunJob queues a run of a job to start now, or as soon as its overlap
+// policy and the concurrency limits allow
+func (c *Client) RunJob(jobID int) (RunQueued, error) {
+	var queued RunQueued
+	err := c.do(context.Background(), http.MethodPost, fmt.Sprintf("/jobs/%d/run", jobID), nil, &queued)
+	return queued, err
+}
+
+// PauseJob stops a job starting runs until it is resumed
+func (c *Client) PauseJob(jobID int) error {
+	return c.do(context.Background(), http.MethodPost, fmt.Sprintf("/jobs/%d/pause", jobID), nil, nil)
+}
+
+// ResumeJob lets a paused job start runs again
+func (c *Client) ResumeJob(jobID int) error {
+	return c.do(context.Background(), http.MethodPost, fmt.Sprintf("/jobs/%d/resume", jobID), nil, nil)
+}
+
+// KillRun stops a running run, or cancels a queued one
+func (c *Client) KillRun(runID int64) error {
+	return c.do(context.Background(), http.MethodPost, fmt.Sprintf("/runs/%d/kill", runID), nil, nil)
+}
+
+// LogQuery picks what RunLog writes of a run's output
+type LogQuery struct {
+	Stream string    // logs.Stdout or logs.Stderr, empty for both
+	Lines  int       // only the last this many lines of each log, 0 for all
+	Since  time.Time // leave out tagged lines written before this, if set
+	Follow bool      // carry on as the run writes output, until it is over
+}
+
+// RunLog writes a run's output to w as q asks
+func (c *Client) RunLog(w io.Writer, runID int64, q LogQuery) error {
+	values := url.Values{}
+	if q.Stream != "" {
+		values.Set("stream", q.Stream)
+	}
+	if q.Lines > 0 {
+		values.Set("lines", strconv.Itoa(q.Lines))
+	}
+	if !q.Since.IsZero() {
+		values.Set("since", strconv.FormatInt(q.Since.Unix(), 10))
+	}
+	if q.Follow {
+		values.Set("follow", "true")
+	}
+	path := fmt.Sprintf("/runs/%d/log", runID)
+	if len(values) > 0 {
+		path += "?" + values.Encode()
+	}
+
+	resp, err := c.send(context.Background(), http.MethodGet, path, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
+
+// Reload makes antd read its run-as policy again and check for due jobs
+func (c *Client) Reload() error {
+	return c.do(context.Background(), http.MethodPost, "/reload", nil, nil)
+}
+
+// do sends a request with body encoded as JSON, if not nil, and decodes
+// the response into out, if not nil
+func (c *Client) do(ctx context.Context, method, path string, body, out any) error {
+	resp, err := c.send(ctx, method, path, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// send sends a request with body encoded as JSON, if not nil, and returns
+// the response if it succeeded, or else the error antd gave
+func (c *Client) send(ctx context.Context, method, path string, body any) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.base+path, reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		var apiErr Error
+		if err := json.NewDecoder(resp.Body).Decode(&apiErr); err != nil || apiErr.Error == "" {
+			return nil, fmt.Errorf("antd answered %s", resp.Status)
+		}
+		return nil, fmt.Errorf("%s", apiErr.Error)
+	}
+	return resp, nil
+}
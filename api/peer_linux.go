@@ -0,0 +1,33 @@
+package api
+
+import (
+	"fmt"
+	"net"
+	"syscall"
+)
+
+// peerUID returns the user ID of the process on the other end of a Unix
+// socket connection, as the kernel recorded it when it connected
+func peerUID(c net.Conn) (int, error) {
+	uc, ok := c.(*net.UnixConn)
+	if !ok {
+		return -1, fmt.Errorf("not a Unix socket connection")
+	}
+	raw, err := uc.SyscallConn()
+	if err != nil {
+		return -1, err
+	}
+
+	var cred *syscall.Ucred
+	var credErr error
+	err = raw.Control(func(fd uintptr) {
+		cred, credErr = syscall.GetsockoptUcred(int(fd), syscall.SOL_SOCKET, syscall.SO_PEERCRED)
+	})
+	if err == nil {
+		err = credErr
+	}
+	if err != nil {
+		return -1, err
+	}
+	return int(cred.Uid), nil
+}
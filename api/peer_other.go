@@ -0,0 +1,13 @@
+//go:build !linux
+
+package api
+
+import (
+	"fmt"
+	"net"
+)
+
+// peerUID is not available without SO_PEERCRED
+func peerUID(c net.Conn) (int, error) {
+	return -1, fmt.Errorf("peer credentials are not supported on this system")
+}
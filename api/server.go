@@ -0,0 +1,130 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/user"
+	"strconv"
+	"syscall"
+)
+
+// Listen creates the socket at path for antd to serve on. Only its owner
+// may connect, along with members of group if it isn't empty. A socket
+// left behind by an antd that is gone is replaced.
+func Listen(path, group string) (net.Listener, error) {
+	if _, err := os.Lstat(path); err == nil {
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("another antd is listening on %s", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+
+	gid := -1
+	mode := os.FileMode(0600)
+	if group != "" {
+		g, err := user.LookupGroup(group)
+		if err != nil {
+			return nil, err
+		}
+		if gid, err = strconv.Atoi(g.Gid); err != nil {
+			return nil, err
+		}
+		mode = 0660
+	}
+
+	// Create the socket closed to everyone, so no one can connect before
+	// its permissions are set
+	old := syscall.Umask(0777)
+	l, err := net.Listen("unix", path)
+	syscall.Umask(old)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.Chown(path, -1, gid); err == nil {
+		err = os.Chmod(path, mode)
+	}
+	if err != nil {
+		l.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+// connKey is the context key ConnContext keeps a request's connection under
+type connKey struct{}
+
+// ConnContext keeps each connection in its requests' context, for Caller.
+// Set it as the http.Server's ConnContext.
+func ConnContext(ctx context.Context, c net.Conn) context.Context {
+	return context.WithValue(ctx, connKey{}, c)
+}
+
+// Caller returns the user a request acts as: the one its token stands
+// for, or else the one on the other end of its Unix socket
+func Caller(r *http.Request) (*user.User, error) {
+	if u, ok := r.Context().Value(userKey{}).(*user.User); ok {
+		return u, nil
+	}
+	conn, ok := r.Context().Value(connKey{}).(net.Conn)
+	if !ok {
+		return nil, fmt.Errorf("no connection recorded for the request")
+	}
+	uid, err := peerUID(conn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to identify caller: %v", err)
+	}
+	return user.LookupId(strconv.Itoa(uid))
+}
+
+// Authorize checks that the caller of r may act on a job submitted by the
+// user with ID uid: only its submitter and root may. Jobs with no recorded
+// submitter, uid -1, belong to the user antd runs as.
+func Authorize(r *http.Request, uid int) error {
+	caller, err := Caller(r)
+	if err != nil {
+		return err
+	}
+	if uid < 0 {
+		uid = os.Getuid()
+	}
+	if caller.Uid != "0" && caller.Uid != strconv.Itoa(uid) {
+		return fmt.Errorf("%s may not act on another user's jobs", caller.Username)
+	}
+	return nil
+}
+
+// ReadJSON decodes a request's body into v, refusing fields v doesn't have
+func ReadJSON(r *http.Request, v any) error {
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf("invalid request body: %v", err)
+	}
+	return nil
+}
+
+// WriteJSON writes v as the response with the given status code
+func WriteJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+// WriteError writes err as the response with the given status code
+func WriteError(w http.ResponseWriter, code int, err error) {
+	WriteJSON(w, code, Error{Error: err.Error()})
+}
+
+// Path returns the path of an endpoint of this version of the API, as an
+// http.ServeMux pattern after the method
+func Path(endpoint string) string {
+	return prefix + endpoint
+}
@@ -0,0 +1,134 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/user"
+	"strings"
+)
+
+// Tokens are the bearer tokens accepted on the HTTP listener, each acting
+// as a user the way a caller on the socket does
+type Tokens struct {
+	tokens []token
+}
+
+type token struct {
+	secret []byte
+	user   *user.User
+}
+
+// LoadTokens reads a token file of lines such as
+//
+//	alice: 6f1c0e8a9b2d4c7e
+//
+// giving the user each token acts as. A user may have several tokens. The
+// file must be readable by its owner only.
+func LoadTokens(path string) (*Tokens, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.Mode().Perm()&0077 != 0 {
+		return nil, fmt.Errorf("%s is open to other users (mode %03o); chmod 600 it", path, info.Mode().Perm())
+	}
+
+	t := &Tokens{}
+	seen := make(map[string]bool)
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		name, secret, ok := strings.Cut(line, ":")
+		name, secret = strings.TrimSpace(name), strings.TrimSpace(secret)
+		if !ok || name == "" || secret == "" || strings.ContainsAny(secret, " \t") {
+			return nil, fmt.Errorf("%s:%d: want user: token", path, n)
+		}
+		if len(secret) < 16 {
+			return nil, fmt.Errorf("%s:%d: token is too short; use at least 16 characters", path, n)
+		}
+		if seen[secret] {
+			return nil, fmt.Errorf("%s:%d: token given twice", path, n)
+		}
+		seen[secret] = true
+		u, err := user.Lookup(name)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, n, err)
+		}
+		t.tokens = append(t.tokens, token{secret: []byte(secret), user: u})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(t.tokens) == 0 {
+		return nil, fmt.Errorf("%s has no tokens", path)
+	}
+	return t, nil
+}
+
+// lookup returns the user a token acts as, or nil if it isn't one. Every
+// token is compared in constant time, so timing reveals none of them.
+func (t *Tokens) lookup(secret string) *user.User {
+	var found *user.User
+	for _, tok := range t.tokens {
+		if subtle.ConstantTimeCompare(tok.secret, []byte(secret)) == 1 {
+			found = tok.user
+		}
+	}
+	return found
+}
+
+// userKey is the context key Authenticate keeps a request's user under
+type userKey struct{}
+
+// Authenticate passes on requests bearing one of the tokens in their
+// Authorization header, as the token's user, and refuses the rest.
+// Requests for the OpenAPI document need no token.
+func (t *Tokens) Authenticate(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == Path(OpenAPIPath) {
+			h.ServeHTTP(w, r)
+			return
+		}
+		secret, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		var u *user.User
+		if ok {
+			u = t.lookup(strings.TrimSpace(secret))
+		}
+		if u == nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="antd"`)
+			WriteError(w, http.StatusUnauthorized, fmt.Errorf("missing or unknown API token"))
+			return
+		}
+		h.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), userKey{}, u)))
+	})
+}
+
+// ListenHTTP listens for the HTTP API on addr, which must be a loopback
+// address such as 127.0.0.1:8321 or localhost:8321. The API is plain HTTP,
+// so it is never offered beyond the machine.
+func ListenHTTP(addr string) (net.Listener, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	if host != "localhost" {
+		if ip := net.ParseIP(host); ip == nil || !ip.IsLoopback() {
+			return nil, fmt.Errorf("%s is not a loopback address", addr)
+		}
+	}
+	return net.Listen("tcp", addr)
+}
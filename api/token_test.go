@@ -0,0 +1,124 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/user"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeTokens writes a token file with the given mode
+func writeTokens(t *testing.T, content string, mode os.FileMode) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "tokens")
+	if err := os.WriteFile(path, []byte(content), mode); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadTokens(t *testing.T) {
+	me, err := user.Current()
+	if err != nil {
+		t.Fatal(err)
+	}
+	good := "# tooling\n" + me.Username + ": 0123456789abcdef\n\n" + me.Username + ": fedcba9876543210 # spare\n"
+	tokens, err := LoadTokens(writeTokens(t, good, 0600))
+	if err != nil {
+		t.Fatalf("LoadTokens unexpected error: %v", err)
+	}
+	if u := tokens.lookup("fedcba9876543210"); u == nil || u.Uid != me.Uid {
+		t.Errorf("lookup of the spare token = %v, want %s", u, me.Username)
+	}
+	if u := tokens.lookup("0123456789abcde"); u != nil {
+		t.Errorf("lookup of a token's prefix = %v, want nil", u)
+	}
+
+	for name, tc := range map[string]struct {
+		content string
+		mode    os.FileMode
+	}{
+		"readable by others": {good, 0644},
+		"no colon":           {me.Username + " 0123456789abcdef\n", 0600},
+		"short token":        {me.Username + ": secret\n", 0600},
+		"repeated token":     {me.Username + ": 0123456789abcdef\nroot: 0123456789abcdef\n", 0600},
+		"unknown user":       {"no-such-user-here: 0123456789abcdef\n", 0600},
+		"empty":              {"# nothing yet\n", 0600},
+	} {
+		if _, err := LoadTokens(writeTokens(t, tc.content, tc.mode)); err == nil {
+			t.Errorf("%s: LoadTokens succeeded, want error", name)
+		}
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	me, err := user.Current()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokens, err := LoadTokens(writeTokens(t, me.Username+": 0123456789abcdef\n", 0600))
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := tokens.Authenticate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		caller, err := Caller(r)
+		if err != nil {
+			WriteError(w, http.StatusForbidden, err)
+			return
+		}
+		w.Write([]byte(caller.Username))
+	}))
+
+	for _, tc := range []struct {
+		path, auth string
+		code       int
+	}{
+		{Path("/jobs"), "Bearer 0123456789abcdef", http.StatusOK},
+		{Path("/jobs"), "", http.StatusUnauthorized},
+		{Path("/jobs"), "Bearer 0123456789abcdeX", http.StatusUnauthorized},
+		{Path("/jobs"), "Basic 0123456789abcdef", http.StatusUnauthorized},
+		{Path(OpenAPIPath), "", http.StatusForbidden}, // let through, with no caller
+	} {
+		req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+		if tc.auth != "" {
+			req.Header.Set("Authorization", tc.auth)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != tc.code {
+			t.Errorf("%s with %q = %d, want %d", tc.path, tc.auth, rec.Code, tc.code)
+		}
+		if rec.Code == http.StatusOK && rec.Body.String() != me.Username {
+			t.Errorf("Caller = %q, want %q", rec.Body.String(), me.Username)
+		}
+	}
+}
+
+func TestListenHTTP(t *testing.T) {
+	for _, addr := range []string{"0.0.0.0:0", ":0", "192.0.2.1:0", "example.com:0", "127.0.0.1"} {
+		if l, err := ListenHTTP(addr); err == nil {
+			l.Close()
+			t.Errorf("ListenHTTP(%q) succeeded, want error", addr)
+		}
+	}
+	l, err := ListenHTTP("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("ListenHTTP unexpected error: %v", err)
+	}
+	l.Close()
+}
+
+func TestOpenAPIDescribesJobSpec(t *testing.T) {
+	doc := string(OpenAPI)
+	fields := reflect.TypeOf(JobSpec{})
+	for i := 0; i < fields.NumField(); i++ {
+		name, _, _ := strings.Cut(fields.Field(i).Tag.Get("json"), ",")
+		if !strings.Contains(doc, "        "+name+":") {
+			t.Errorf("OpenAPI document doesn't describe JobSpec field %s", name)
+		}
+	}
+}
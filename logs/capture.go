@@ -0,0 +1,163 @@
+package logs
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Output modes: how a run's stdout and stderr are captured
+const (
+	Combined = "combined" // both as written, in the main log
+	Separate = "separate" // stdout in the main log, stderr in a log of its own
+	Tagged   = "tagged"   // both in the main log, line by line with a timestamp and stream tag
+)
+
+// TimeFormat is the timestamp at the start of each tagged line
+const TimeFormat = "2006-01-02T15:04:05.000Z07:00"
+
+// ParseOutput checks the name of an output mode
+func ParseOutput(mode string) (string, error) {
+	switch mode {
+	case Combined, Separate, Tagged:
+		return mode, nil
+	}
+	return "", fmt.Errorf("unknown output mode %q: want combined, separate or tagged", mode)
+}
+
+// Capture opens a run's logs and connects cmd's stdout and stderr to them
+// as mode says. Call the returned function once cmd has started, or failed
+// to: it closes what antd doesn't need. Tagged output is copied from pipes
+// until every process of the run has closed them, so it stops if antd does.
+func Capture(cmd *exec.Cmd, dir string, jobID int, runID int64, mode string) (func(), error) {
+	main, err := Create(dir, jobID, runID, "")
+	if err != nil {
+		return nil, err
+	}
+
+	switch mode {
+	case Separate:
+		stderr, err := Create(dir, jobID, runID, Stderr)
+		if err != nil {
+			main.Close()
+			return nil, err
+		}
+		cmd.Stdout, cmd.Stderr = main, stderr
+		return func() { main.Close(); stderr.Close() }, nil
+
+	case Tagged:
+		outR, outW, err := os.Pipe()
+		if err != nil {
+			main.Close()
+			return nil, err
+		}
+		errR, errW, err := os.Pipe()
+		if err != nil {
+			main.Close()
+			outR.Close()
+			outW.Close()
+			return nil, err
+		}
+		cmd.Stdout, cmd.Stderr = outW, errW
+
+		return func() {
+			// The run holds its own copies of the write ends
+			outW.Close()
+			errW.Close()
+
+			t := NewTagger(main)
+			var wg sync.WaitGroup
+			wg.Add(2)
+			go func() { defer wg.Done(); t.Copy(Stdout, outR); outR.Close() }()
+			go func() { defer wg.Done(); t.Copy(Stderr, errR); errR.Close() }()
+			go func() { wg.Wait(); main.Close() }()
+		}, nil
+	}
+
+	cmd.Stdout, cmd.Stderr = main, main
+	return func() { main.Close() }, nil
+}
+
+// Tagger interleaves streams line by line in one log, prefixing each line
+// with the time it was read and the stream it came from
+type Tagger struct {
+	mu  sync.Mutex
+	w   io.Writer
+	now func() time.Time
+}
+
+// NewTagger returns a Tagger writing to w
+func NewTagger(w io.Writer) *Tagger {
+	return &Tagger{w: w, now: time.Now}
+}
+
+// Copy tags the lines read from r until it ends. A last line without a
+// newline gets one.
+func (t *Tagger) Copy(stream string, r io.Reader) error {
+	br := bufio.NewReader(r)
+	for {
+		line, err := br.ReadString('\n')
+		if line != "" {
+			if werr := t.write(stream, strings.TrimSuffix(line, "\n")); werr != nil {
+				return werr
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// write writes one tagged line in a single write, so lines from different
+// streams don't mix
+func (t *Tagger) write(stream, text string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	_, err := io.WriteString(t.w, t.now().Format(TimeFormat)+" "+stream+" "+text+"\n")
+	return err
+}
+
+// ParseLine splits a tagged line into its time, stream and text. ok is
+// false for lines that aren't tagged.
+func ParseLine(line string) (at time.Time, stream, text string, ok bool) {
+	stamp, rest, found := strings.Cut(line, " ")
+	if !found {
+		return time.Time{}, "", "", false
+	}
+	stream, text, found = strings.Cut(rest, " ")
+	if !found || (stream != Stdout && stream != Stderr) {
+		return time.Time{}, "", "", false
+	}
+	at, err := time.Parse(TimeFormat, stamp)
+	if err != nil {
+		return time.Time{}, "", "", false
+	}
+	return at, stream, strings.TrimSuffix(text, "\n"), true
+}
+
+// Filter picks lines of a tagged log by stream and time
+type Filter struct {
+	Stream string    // Stdout or Stderr, empty for both
+	Since  time.Time // drop lines from before this, if set
+}
+
+// Keep reports whether a line passes the filter. Lines that aren't tagged
+// always do.
+func (f Filter) Keep(line string) bool {
+	at, stream, _, ok := ParseLine(line)
+	if !ok {
+		return true
+	}
+	if f.Stream != "" && stream != f.Stream {
+		return false
+	}
+	return f.Since.IsZero() || !at.Before(f.Since)
+}
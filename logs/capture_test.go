@@ -0,0 +1,128 @@
+package logs
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTagger(t *testing.T) {
+	var b strings.Builder
+	tagger := NewTagger(&b)
+	at := time.Date(2026, time.October, 14, 12, 0, 0, 0, time.UTC)
+	tagger.now = func() time.Time { return at }
+
+	if err := tagger.Copy(Stdout, strings.NewReader("one\ntwo")); err != nil {
+		t.Fatal(err)
+	}
+	if err := tagger.Copy(Stderr, strings.NewReader("oops\n")); err != nil {
+		t.Fatal(err)
+	}
+	want := "2026-10-14T12:00:00.000Z out one\n" +
+		"2026-10-14T12:00:00.000Z out two\n" +
+		"2026-10-14T12:00:00.000Z err oops\n"
+	if b.String() != want {
+		t.Fatalf("tagged output = %q, want %q", b.String(), want)
+	}
+
+	got, stream, text, ok := ParseLine("2026-10-14T12:00:00.000Z err oops\n")
+	if !ok || !got.Equal(at) || stream != Stderr || text != "oops" {
+		t.Errorf("ParseLine = %v, %q, %q, %v", got, stream, text, ok)
+	}
+	for _, line := range []string{"plain output\n", "2026-10-14 out x\n", "2026-10-14T12:00:00.000Z warn x\n"} {
+		if _, _, _, ok := ParseLine(line); ok {
+			t.Errorf("ParseLine(%q) parsed an untagged line", line)
+		}
+	}
+}
+
+func TestFilter(t *testing.T) {
+	early := "2026-10-14T11:00:00.000Z out early\n"
+	late := "2026-10-14T13:00:00.000Z err late\n"
+	plain := "untagged\n"
+	since := time.Date(2026, time.October, 14, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		filter Filter
+		line   string
+		want   bool
+	}{
+		{Filter{}, early, true},
+		{Filter{Stream: Stderr}, early, false},
+		{Filter{Stream: Stderr}, late, true},
+		{Filter{Since: since}, early, false},
+		{Filter{Since: since}, late, true},
+		{Filter{Stream: Stdout, Since: since}, plain, true},
+	}
+	for _, tt := range tests {
+		if got := tt.filter.Keep(tt.line); got != tt.want {
+			t.Errorf("%+v.Keep(%q) = %v, want %v", tt.filter, tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestCapture(t *testing.T) {
+	script := "echo to stdout; echo to stderr >&2"
+	for _, mode := range []string{Combined, Separate, Tagged} {
+		t.Run(mode, func(t *testing.T) {
+			dir := t.TempDir()
+			cmd := exec.Command("sh", "-c", script)
+			started, err := Capture(cmd, dir, 1, 5, mode)
+			if err != nil {
+				t.Fatalf("Capture unexpected error: %v", err)
+			}
+			err = cmd.Start()
+			started()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := cmd.Wait(); err != nil {
+				t.Fatal(err)
+			}
+
+			read := func(stream string) string {
+				// Tagged output is written after the run has exited
+				for i := 0; i < 50; i++ {
+					data, _ := os.ReadFile(RunFile(dir, 1, 5, stream))
+					if mode != Tagged || strings.Count(string(data), "\n") == 2 {
+						return string(data)
+					}
+					time.Sleep(10 * time.Millisecond)
+				}
+				t.Fatal("tagged output never arrived")
+				return ""
+			}
+
+			main := read("")
+			switch mode {
+			case Combined:
+				if main != "to stdout\nto stderr\n" {
+					t.Errorf("log = %q", main)
+				}
+			case Separate:
+				if main != "to stdout\n" || read(Stderr) != "to stderr\n" {
+					t.Errorf("logs = %q and %q", main, read(Stderr))
+				}
+			case Tagged:
+				var tags []string
+				for _, line := range strings.SplitAfter(strings.TrimSuffix(main, "\n"), "\n") {
+					_, stream, text, ok := ParseLine(line)
+					if !ok {
+						t.Fatalf("untagged line %q", line)
+					}
+					tags = append(tags, stream+":"+text)
+				}
+				got := strings.Join(tags, ",")
+				if !strings.Contains(got, "out:to stdout") || !strings.Contains(got, "err:to stderr") {
+					t.Errorf("tagged lines = %q", got)
+				}
+			}
+		})
+	}
+
+	if _, err := ParseOutput("split"); err == nil {
+		t.Error("ParseOutput(\"split\") succeeded, want error")
+	}
+}
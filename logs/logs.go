@@ -0,0 +1,178 @@
+// Package logs lays out the output of job runs on disk, one file per run in
+// a directory per job, and rotates, compresses and prunes those files.
+//
+// A run writes to job-<id>/run-<run>.log, and to run-<run>.err.log as well
+// if it keeps stderr apart. While it runs, output rotated out of a file goes
+// to <file>.1, .2 and so on, newest first. Any of these may carry a .gz
+// suffix once compressed.
+package logs
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Stream names, as used in tagged lines and for the stderr log of a run
+// that keeps its streams apart
+const (
+	Stdout = "out"
+	Stderr = "err"
+)
+
+// Dir returns the log directory that goes with the database at dbPath
+func Dir(dbPath string) string {
+	return filepath.Join(filepath.Dir(dbPath), "logs")
+}
+
+// JobDir returns the directory holding the logs of a job's runs
+func JobDir(dir string, jobID int) string {
+	return filepath.Join(dir, fmt.Sprintf("job-%d", jobID))
+}
+
+// RunFile returns the file a run writes its output to: stream is empty for
+// its main log, or Stderr for stderr kept apart
+func RunFile(dir string, jobID int, runID int64, stream string) string {
+	name := fmt.Sprintf("run-%d.log", runID)
+	if stream != "" {
+		name = fmt.Sprintf("run-%d.%s.log", runID, stream)
+	}
+	return filepath.Join(JobDir(dir, jobID), name)
+}
+
+// Create opens a run's log for appending, creating its job's directory if
+// need be. Rotation relies on the file being opened to append. Logs are
+// open to antd's own user only, who hands them out to the jobs' owners;
+// a job directory left open by an older antd is closed again.
+func Create(dir string, jobID int, runID int64, stream string) (*os.File, error) {
+	jobDir := JobDir(dir, jobID)
+	if err := os.MkdirAll(jobDir, 0700); err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(jobDir, 0700); err != nil {
+		return nil, err
+	}
+	return os.OpenFile(RunFile(dir, jobID, runID, stream), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+}
+
+// Run is one log of a run
+type Run struct {
+	ID       int64
+	Stream   string    // empty for the main log, or Stderr
+	Path     string    // the file the run writes to, or its compressed copy
+	Segments []string  // output rotated out of Path, oldest first
+	ModTime  time.Time // last change to any of its files
+}
+
+// Files returns the log's files in the order they were written
+func (r Run) Files() []string {
+	return append(append([]string(nil), r.Segments...), r.Path)
+}
+
+// logKey identifies one log of a run
+type logKey struct {
+	runID  int64
+	stream string
+}
+
+// Runs lists the logs of a job's runs in run order, the main log of each
+// run before its stderr log. A job without logs has none.
+func Runs(dir string, jobID int) ([]Run, error) {
+	jobDir := JobDir(dir, jobID)
+	entries, err := os.ReadDir(jobDir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	runs := make(map[logKey]*Run)
+	segments := make(map[logKey]map[int]string)
+	for _, entry := range entries {
+		runID, stream, segment, ok := parseName(entry.Name())
+		if !ok {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue // removed since the directory was read
+		}
+
+		key := logKey{runID, stream}
+		run := runs[key]
+		if run == nil {
+			run = &Run{ID: runID, Stream: stream}
+			runs[key] = run
+			segments[key] = make(map[int]string)
+		}
+		path := filepath.Join(jobDir, entry.Name())
+		if segment == 0 {
+			run.Path = path
+		} else {
+			segments[key][segment] = path
+		}
+		if info.ModTime().After(run.ModTime) {
+			run.ModTime = info.ModTime()
+		}
+	}
+
+	var list []Run
+	for key, run := range runs {
+		if run.Path == "" {
+			run.Path = RunFile(dir, jobID, key.runID, key.stream)
+		}
+		// Higher segment numbers are older
+		numbers := make([]int, 0, len(segments[key]))
+		for n := range segments[key] {
+			numbers = append(numbers, n)
+		}
+		sort.Sort(sort.Reverse(sort.IntSlice(numbers)))
+		for _, n := range numbers {
+			run.Segments = append(run.Segments, segments[key][n])
+		}
+		list = append(list, *run)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].ID != list[j].ID {
+			return list[i].ID < list[j].ID
+		}
+		return list[i].Stream < list[j].Stream
+	})
+	return list, nil
+}
+
+// parseName reads the run ID, stream and segment number, 0 for the file
+// the run writes to, from the name of a log file
+func parseName(name string) (runID int64, stream string, segment int, ok bool) {
+	name = strings.TrimSuffix(name, ".gz")
+	rest, found := strings.CutPrefix(name, "run-")
+	if !found {
+		return 0, "", 0, false
+	}
+	id, suffix, found := strings.Cut(rest, ".log")
+	if !found {
+		return 0, "", 0, false
+	}
+	id, stream, _ = strings.Cut(id, ".")
+	if stream != "" && stream != Stderr {
+		return 0, "", 0, false
+	}
+	runID, err := strconv.ParseInt(id, 10, 64)
+	if err != nil || runID < 0 {
+		return 0, "", 0, false
+	}
+	if suffix == "" {
+		return runID, stream, 0, true
+	}
+	number, found := strings.CutPrefix(suffix, ".")
+	segment, err = strconv.Atoi(number)
+	if !found || err != nil || segment < 1 {
+		return 0, "", 0, false
+	}
+	return runID, stream, segment, true
+}
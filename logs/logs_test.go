@@ -0,0 +1,193 @@
+package logs
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// writeLog creates a log file under dir with the given content and age
+func writeLog(t *testing.T, dir, name, content string, age time.Duration) {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	modTime := time.Now().Add(-age)
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// names lists the files in a job's log directory
+func names(t *testing.T, dir string, jobID int) []string {
+	t.Helper()
+	entries, err := os.ReadDir(JobDir(dir, jobID))
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	var list []string
+	for _, entry := range entries {
+		list = append(list, entry.Name())
+	}
+	return list
+}
+
+func TestRuns(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{
+		"job-3/run-10.log", "job-3/run-10.log.1.gz", "job-3/run-10.log.2",
+		"job-3/run-9.log.gz", "job-3/run-9.err.log", "job-3/notes.txt",
+		"job-3/run-x.log", "job-3/run-9.out.log",
+	} {
+		writeLog(t, dir, name, "output\n", 0)
+	}
+
+	runs, err := Runs(dir, 3)
+	if err != nil {
+		t.Fatalf("Runs unexpected error: %v", err)
+	}
+	if len(runs) != 3 || runs[0].ID != 9 || runs[1].ID != 9 || runs[1].Stream != Stderr || runs[2].ID != 10 {
+		t.Fatalf("Runs = %+v, want run 9 and its stderr, then run 10", runs)
+	}
+	jobDir := JobDir(dir, 3)
+	want := []string{
+		filepath.Join(jobDir, "run-10.log.2"),
+		filepath.Join(jobDir, "run-10.log.1.gz"),
+		filepath.Join(jobDir, "run-10.log"),
+	}
+	if got := runs[2].Files(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Files() = %q, want %q", got, want)
+	}
+
+	if runs, err := Runs(dir, 4); err != nil || len(runs) != 0 {
+		t.Errorf("Runs of a job without logs = %v, %v, want none", runs, err)
+	}
+}
+
+func TestMaintainPrunes(t *testing.T) {
+	dir := t.TempDir()
+	writeLog(t, dir, "job-1/run-1.log", "old\n", 48*time.Hour)
+	writeLog(t, dir, "job-1/run-2.log", "a\n", time.Hour)
+	writeLog(t, dir, "job-1/run-3.log", "b\n", time.Hour)
+	writeLog(t, dir, "job-1/run-4.log", "c\n", time.Hour)
+	writeLog(t, dir, "job-1/run-4.err.log", "c\n", time.Hour)
+	writeLog(t, dir, "job-1/run-2.err.log", "a\n", time.Hour)
+	writeLog(t, dir, "job-1/run-5.log", "running\n", 72*time.Hour)
+	writeLog(t, dir, "job-2/run-6.log", "d\n", time.Hour)
+	writeLog(t, dir, "job-2/run-7.log", "e\n", time.Hour)
+
+	p := Policy{MaxAge: 24 * time.Hour, Keep: 2, Compress: true}
+	active := func(runID int64) bool { return runID == 5 }
+	if err := Maintain(dir, p, active, map[int]int{2: 5}); err != nil {
+		t.Fatalf("Maintain unexpected error: %v", err)
+	}
+
+	// Run 1 is too old, run 2 one too many; run 5 is still writing
+	want := []string{"run-3.log.gz", "run-4.err.log.gz", "run-4.log.gz", "run-5.log"}
+	if got := names(t, dir, 1); !reflect.DeepEqual(got, want) {
+		t.Errorf("job 1 logs = %q, want %q", got, want)
+	}
+	want = []string{"run-6.log.gz", "run-7.log.gz"}
+	if got := names(t, dir, 2); !reflect.DeepEqual(got, want) {
+		t.Errorf("job 2 logs = %q, want %q", got, want)
+	}
+
+	f, err := os.Open(filepath.Join(JobDir(dir, 1), "run-4.log.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, err := io.ReadAll(zr); err != nil || string(data) != "c\n" {
+		t.Errorf("compressed log = %q, %v, want %q", data, err, "c\n")
+	}
+}
+
+func TestMaintainRotates(t *testing.T) {
+	dir := t.TempDir()
+	p := Policy{MaxSize: 10, Segments: 2}
+	active := func(int64) bool { return true }
+
+	f, err := Create(dir, 1, 8, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	// Each write past the limit is rotated out; only two segments are kept
+	for _, chunk := range []string{"first chunk\n", "second chunk\n", "third chunk\n"} {
+		if _, err := f.WriteString(chunk); err != nil {
+			t.Fatal(err)
+		}
+		if err := Maintain(dir, p, active, nil); err != nil {
+			t.Fatalf("Maintain unexpected error: %v", err)
+		}
+	}
+	if _, err := f.WriteString("tail\n"); err != nil {
+		t.Fatal(err)
+	}
+
+	read := func(name string) string {
+		data, err := os.ReadFile(filepath.Join(JobDir(dir, 1), name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+	if got := names(t, dir, 1); !reflect.DeepEqual(got, []string{"run-8.log", "run-8.log.1", "run-8.log.2"}) {
+		t.Fatalf("logs = %q", got)
+	}
+	// The writer appends, so it carries on at the start of the truncated file
+	got := read("run-8.log.2") + read("run-8.log.1") + read("run-8.log")
+	if want := "second chunk\nthird chunk\ntail\n"; got != want {
+		t.Errorf("rotated output = %q, want %q", got, want)
+	}
+}
+
+func TestModes(t *testing.T) {
+	dir := t.TempDir()
+	f, err := Create(dir, 1, 8, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString("more than ten bytes\n"); err != nil {
+		t.Fatal(err)
+	}
+	p := Policy{MaxSize: 10, Segments: 2, Compress: true}
+	if err := Maintain(dir, p, func(int64) bool { return true }, nil); err != nil {
+		t.Fatalf("Maintain unexpected error: %v", err)
+	}
+
+	// Other users can't read a run's output, rotated or not
+	info, err := os.Stat(JobDir(dir, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0700 {
+		t.Errorf("job directory mode = %v, want 0700", info.Mode().Perm())
+	}
+	if got := names(t, dir, 1); !reflect.DeepEqual(got, []string{"run-8.log", "run-8.log.1.gz"}) {
+		t.Fatalf("logs = %q", got)
+	}
+	for _, name := range names(t, dir, 1) {
+		info, err := os.Stat(filepath.Join(JobDir(dir, 1), name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != 0600 {
+			t.Errorf("%s mode = %v, want 0600", name, info.Mode().Perm())
+		}
+	}
+}
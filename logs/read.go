@@ -0,0 +1,227 @@
+package logs
+
+import (
+	"bufio"
+	"compress/gzip"
+	"io"
+	"os"
+	"strings"
+)
+
+// Open opens a log file for reading, decompressing it if it is gzipped
+func Open(path string) (io.ReadCloser, error) {
+	f, err := os.Open(path)
+	if err != nil || !strings.HasSuffix(path, ".gz") {
+		return f, err
+	}
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &gzipFile{zr, f}, nil
+}
+
+// gzipFile closes the file under a gzip reader along with it
+type gzipFile struct {
+	*gzip.Reader
+	file *os.File
+}
+
+func (g *gzipFile) Close() error {
+	g.Reader.Close()
+	return g.file.Close()
+}
+
+// Tail writes the last n lines of a run's log to w, or all of it if n is 0,
+// leaving out lines keep rejects if it isn't nil. It returns how far it
+// read into the file the run writes to, which is where following the run
+// carries on from.
+func Tail(w io.Writer, run Run, n int, keep func(line string) bool) (int64, error) {
+	var lines []string
+	var offset int64
+	for _, path := range run.Files() {
+		offset = 0
+		r, err := Open(path)
+		if os.IsNotExist(err) {
+			continue // pruned or compressed since the run was listed
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		read := &countingReader{r: r}
+		switch {
+		case n == 0 && keep == nil:
+			_, err = io.Copy(w, read)
+		case n == 0:
+			err = eachLine(read, func(line string) error {
+				if !keep(line) {
+					return nil
+				}
+				_, err := io.WriteString(w, line)
+				return err
+			})
+		default:
+			err = eachLine(read, func(line string) error {
+				if keep == nil || keep(line) {
+					lines = append(lines, line)
+					if len(lines) > n {
+						lines = lines[1:]
+					}
+				}
+				return nil
+			})
+		}
+		r.Close()
+		if err != nil {
+			return 0, err
+		}
+		offset = read.n
+	}
+
+	for _, line := range lines {
+		if _, err := io.WriteString(w, line); err != nil {
+			return 0, err
+		}
+	}
+	return offset, nil
+}
+
+// eachLine calls fn with each line read from r, newline included
+func eachLine(r io.Reader, fn func(line string) error) error {
+	br := bufio.NewReader(r)
+	for {
+		line, err := br.ReadString('\n')
+		if line != "" {
+			if err := fn(line); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// Follower reads what a running run appends to its log, carrying on
+// through rotation
+type Follower struct {
+	// Keep, if set, picks the lines to write. Lines are then only written
+	// once complete.
+	Keep func(line string) bool
+
+	path    string
+	file    *os.File
+	offset  int64
+	segment os.FileInfo // newest segment when last polled, nil if none
+	partial string      // start of a line not yet complete, when filtering
+}
+
+// Follow starts following the log at path from offset
+func Follow(path string, offset int64) (*Follower, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	follower := &Follower{path: path, file: f, offset: offset}
+	follower.segment, _ = follower.newestSegment()
+	return follower, nil
+}
+
+// Poll writes whatever has been added to the log since the last call to w
+func (f *Follower) Poll(w io.Writer) error {
+	info, err := f.file.Stat()
+	if err != nil {
+		return err
+	}
+
+	// A new segment means the file has been rotated and truncated, and the
+	// rest of what it held before is in that segment
+	segment, path := f.newestSegment()
+	rotated := segment != nil && (f.segment == nil || !os.SameFile(segment, f.segment))
+	if rotated || info.Size() < f.offset {
+		if path != "" {
+			if err := f.readRotated(w, path); err != nil {
+				return err
+			}
+		}
+		f.offset = 0
+		f.segment = segment
+	}
+
+	n, err := f.copy(w, io.NewSectionReader(f.file, f.offset, info.Size()-f.offset))
+	f.offset += n
+	return err
+}
+
+// copy writes what it reads from r to w, a line at a time if filtering
+func (f *Follower) copy(w io.Writer, r io.Reader) (int64, error) {
+	if f.Keep == nil {
+		return io.Copy(w, r)
+	}
+
+	read := &countingReader{r: r}
+	err := eachLine(read, func(line string) error {
+		line = f.partial + line
+		f.partial = ""
+		if !strings.HasSuffix(line, "\n") {
+			f.partial = line
+			return nil
+		}
+		if !f.Keep(line) {
+			return nil
+		}
+		_, err := io.WriteString(w, line)
+		return err
+	})
+	return read.n, err
+}
+
+// newestSegment returns the newest segment rotated out of the log and its
+// path, or nil if there is none
+func (f *Follower) newestSegment() (os.FileInfo, string) {
+	for _, path := range []string{f.path + ".1", f.path + ".1.gz"} {
+		if info, err := os.Stat(path); err == nil {
+			return info, path
+		}
+	}
+	return nil, ""
+}
+
+// readRotated writes the part of a segment past the offset
+func (f *Follower) readRotated(w io.Writer, path string) error {
+	r, err := Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	if _, err := io.CopyN(io.Discard, r, f.offset); err != nil {
+		return nil // rotated on again since, so shorter than expected
+	}
+	_, err = f.copy(w, r)
+	return err
+}
+
+// Close stops following the log
+func (f *Follower) Close() error {
+	return f.file.Close()
+}
@@ -0,0 +1,93 @@
+package logs
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTail(t *testing.T) {
+	dir := t.TempDir()
+	writeLog(t, dir, "job-1/run-4.log.2", "one\ntwo\n", 0)
+	writeLog(t, dir, "job-1/run-4.log.1", "three\nfour\n", 0)
+	writeLog(t, dir, "job-1/run-4.log", "five\nsix", 0)
+	if err := compress(filepath.Join(JobDir(dir, 1), "run-4.log.1")); err != nil {
+		t.Fatal(err)
+	}
+
+	runs, err := Runs(dir, 1)
+	if err != nil || len(runs) != 1 {
+		t.Fatalf("Runs = %v, %v, want one run", runs, err)
+	}
+
+	tests := []struct {
+		n    int
+		want string
+	}{
+		{0, "one\ntwo\nthree\nfour\nfive\nsix"},
+		{3, "four\nfive\nsix"},
+		{10, "one\ntwo\nthree\nfour\nfive\nsix"},
+	}
+	for _, tt := range tests {
+		var b strings.Builder
+		offset, err := Tail(&b, runs[0], tt.n, nil)
+		if err != nil {
+			t.Fatalf("Tail(%d) unexpected error: %v", tt.n, err)
+		}
+		if b.String() != tt.want {
+			t.Errorf("Tail(%d) = %q, want %q", tt.n, b.String(), tt.want)
+		}
+		if offset != int64(len("five\nsix")) {
+			t.Errorf("Tail(%d) offset = %d, want %d", tt.n, offset, len("five\nsix"))
+		}
+	}
+}
+
+func TestFollowerThroughRotation(t *testing.T) {
+	dir := t.TempDir()
+	f, err := Create(dir, 1, 2, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	follower, err := Follow(RunFile(dir, 1, 2, ""), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer follower.Close()
+
+	var b strings.Builder
+	write := func(s string) {
+		t.Helper()
+		if _, err := f.WriteString(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	poll := func() {
+		t.Helper()
+		if err := follower.Poll(&b); err != nil {
+			t.Fatalf("Poll unexpected error: %v", err)
+		}
+	}
+
+	write("first line\n")
+	poll()
+	// Written after the last poll but rotated away before the next one
+	write("second line\n")
+	p := Policy{MaxSize: 1, Segments: 2, Compress: true}
+	if err := Maintain(dir, p, func(int64) bool { return true }, nil); err != nil {
+		t.Fatal(err)
+	}
+	write("third line\n")
+	poll()
+	poll()
+
+	if want := "first line\nsecond line\nthird line\n"; b.String() != want {
+		t.Errorf("followed %q, want %q", b.String(), want)
+	}
+	if _, err := os.Stat(RunFile(dir, 1, 2, "") + ".1.gz"); err != nil {
+		t.Errorf("rotated segment missing: %v", err)
+	}
+}
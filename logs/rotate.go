@@ -0,0 +1,225 @@
+package logs
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Policy says how much of the logs to keep
+type Policy struct {
+	MaxSize  int64         // rotate a running run's log once it grows past this, 0 for never
+	Segments int           // rotated segments kept per run, at least 1
+	MaxAge   time.Duration // remove logs of finished runs not written for this long, 0 for never
+	Keep     int           // logs of finished runs kept per job, 0 for all
+	Compress bool          // gzip rotated segments and the logs of finished runs
+}
+
+// Maintain applies the policy to the logs of every job. active reports
+// whether a run may still be writing its log, in which case it is rotated
+// rather than compressed or pruned. keep overrides Policy.Keep for the jobs
+// in it.
+func Maintain(dir string, p Policy, active func(runID int64) bool, keep map[int]int) error {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var errs []string
+	for _, entry := range entries {
+		jobID, err := strconv.Atoi(strings.TrimPrefix(entry.Name(), "job-"))
+		if !entry.IsDir() || err != nil {
+			continue
+		}
+		jp := p
+		if n, ok := keep[jobID]; ok && n > 0 {
+			jp.Keep = n
+		}
+		if err := maintainJob(dir, jobID, jp, active); err != nil {
+			errs = append(errs, fmt.Sprintf("job %d: %v", jobID, err))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// maintainJob rotates the logs of a job's running runs and compresses and
+// prunes those of its finished runs
+func maintainJob(dir string, jobID int, p Policy, active func(runID int64) bool) error {
+	runs, err := Runs(dir, jobID)
+	if err != nil {
+		return err
+	}
+
+	// A finished run's logs are kept or dropped together, going by the
+	// last time any of them changed
+	var finished []int64
+	lastChange := make(map[int64]time.Time)
+	for _, run := range runs {
+		if active(run.ID) {
+			if err := rotate(run, p); err != nil {
+				return err
+			}
+			continue
+		}
+		if _, ok := lastChange[run.ID]; !ok {
+			finished = append(finished, run.ID)
+		}
+		if run.ModTime.After(lastChange[run.ID]) {
+			lastChange[run.ID] = run.ModTime
+		}
+	}
+
+	// Runs are in order, so the oldest go first
+	cutoff := time.Now().Add(-p.MaxAge)
+	drop := make(map[int64]bool)
+	for i, id := range finished {
+		tooMany := p.Keep > 0 && len(finished)-i > p.Keep
+		tooOld := p.MaxAge > 0 && lastChange[id].Before(cutoff)
+		drop[id] = tooMany || tooOld
+	}
+
+	for _, run := range runs {
+		if active(run.ID) {
+			continue
+		}
+		if drop[run.ID] {
+			if err := remove(run); err != nil {
+				return err
+			}
+			continue
+		}
+		if p.Compress {
+			for _, path := range run.Files() {
+				if err := compress(path); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	// Drop the directory of a job with nothing left; it fails harmlessly
+	// if a run has just created a file in it
+	os.Remove(JobDir(dir, jobID))
+	return nil
+}
+
+// rotate moves the output of a running run into a new segment once its log
+// is too big. The run keeps its file open, so the output is copied out and
+// the file truncated; output written in between is lost.
+func rotate(run Run, p Policy) error {
+	info, err := os.Stat(run.Path)
+	if err != nil || p.MaxSize <= 0 || info.Size() <= p.MaxSize {
+		return nil
+	}
+
+	// Make room for segment 1, oldest first so nothing is overwritten, and
+	// drop those beyond the limit
+	keep := max(p.Segments, 1)
+	for _, path := range run.Segments {
+		_, _, n, _ := parseName(filepath.Base(path))
+		if n >= keep {
+			if err := os.Remove(path); err != nil {
+				return err
+			}
+			continue
+		}
+		next := strings.Replace(path, fmt.Sprintf(".log.%d", n), fmt.Sprintf(".log.%d", n+1), 1)
+		if err := os.Rename(path, next); err != nil {
+			return err
+		}
+	}
+
+	segment := run.Path + ".1"
+	if err := copyFile(run.Path, segment); err != nil {
+		return err
+	}
+	if err := os.Truncate(run.Path, 0); err != nil {
+		return err
+	}
+	if p.Compress {
+		return compress(segment)
+	}
+	return nil
+}
+
+// remove deletes every file of a run's log
+func remove(run Run) error {
+	for _, path := range run.Files() {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// compress replaces a file with a gzipped copy, unless it already is one
+func compress(path string) error {
+	if strings.HasSuffix(path, ".gz") {
+		return nil
+	}
+	src, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".compress-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	zw := gzip.NewWriter(tmp)
+	zw.Name = filepath.Base(path)
+	_, err = io.Copy(zw, src)
+	if err == nil {
+		err = zw.Close()
+	}
+	if err == nil {
+		err = tmp.Chmod(0600)
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp.Name(), path+".gz"); err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
+
+// copyFile copies src to a new file dst
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,229 @@
+package runner
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// limitControllers are the controllers Limits are applied through
+var limitControllers = []string{"cpu", "memory", "pids", "io"}
+
+// Cgroups puts each run in a cgroup v2 leaf of its own, under a subtree
+// delegated to antd, to apply resource limits and measure usage
+type Cgroups struct {
+	root        string
+	controllers map[string]bool // enabled for the leaves
+}
+
+// Cgroup is the leaf of a single run
+type Cgroup struct {
+	path string
+	dir  *os.File
+}
+
+// OpenCgroups prepares the delegated subtree at root, or the cgroup the
+// calling process is in if root is empty. Since a cgroup can't both hold
+// processes and pass controllers on to its children, the caller is moved
+// into a leaf named "antd" first; controllers stay off if anything else
+// is left in root. It fails if there is no cgroup v2 hierarchy, the
+// subtree isn't writable, or the kernel can't start a process straight
+// into a cgroup.
+func OpenCgroups(root string) (*Cgroups, error) {
+	mount, err := cgroup2Mount()
+	if err != nil {
+		return nil, err
+	}
+	if root == "" {
+		own, err := ownCgroup()
+		if err != nil {
+			return nil, err
+		}
+		root = filepath.Join(mount, own)
+	}
+
+	c := &Cgroups{root: root, controllers: make(map[string]bool)}
+	if err := c.moveSelf("antd"); err != nil {
+		return nil, fmt.Errorf("cgroup %s is not delegated: %v", root, err)
+	}
+
+	available, err := os.ReadFile(filepath.Join(root, "cgroup.controllers"))
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range strings.Fields(string(available)) {
+		for _, wanted := range limitControllers {
+			if name == wanted && writeCgroupFile(root, "cgroup.subtree_control", "+"+name) == nil {
+				c.controllers[name] = true
+			}
+		}
+	}
+
+	if err := c.probe(); err != nil {
+		return nil, fmt.Errorf("cannot start processes in a cgroup: %v", err)
+	}
+	return c, nil
+}
+
+// Root returns the delegated cgroup directory
+func (c *Cgroups) Root() string {
+	return c.root
+}
+
+// Create makes a leaf for a run and applies limits to it. It fails if a
+// limit needs a controller that wasn't delegated.
+func (c *Cgroups) Create(name string, limits Limits) (*Cgroup, error) {
+	path := filepath.Join(c.root, name)
+	if err := os.Mkdir(path, 0755); err != nil {
+		return nil, err
+	}
+	g := &Cgroup{path: path}
+
+	settings := []struct {
+		set        bool
+		controller string
+		file       string
+		value      string
+	}{
+		{limits.CPUWeight > 0, "cpu", "cpu.weight", strconv.Itoa(limits.CPUWeight)},
+		{limits.CPUQuota > 0, "cpu", "cpu.max", fmt.Sprintf("%d 100000", limits.CPUQuota*1000)},
+		{limits.MemoryMax > 0, "memory", "memory.max", strconv.FormatInt(limits.MemoryMax, 10)},
+		{limits.PidsMax > 0, "pids", "pids.max", strconv.Itoa(limits.PidsMax)},
+		{limits.IOWeight > 0, "io", "io.weight", "default " + strconv.Itoa(limits.IOWeight)},
+	}
+	for _, setting := range settings {
+		if !setting.set {
+			continue
+		}
+		if !c.controllers[setting.controller] {
+			g.Remove()
+			return nil, fmt.Errorf("the %s controller is not delegated to %s", setting.controller, c.root)
+		}
+		if err := writeCgroupFile(path, setting.file, setting.value); err != nil {
+			g.Remove()
+			return nil, err
+		}
+	}
+
+	dir, err := os.Open(path)
+	if err != nil {
+		g.Remove()
+		return nil, err
+	}
+	g.dir = dir
+	return g, nil
+}
+
+// Apply makes a command started with attr begin life inside the cgroup
+func (g *Cgroup) Apply(attr *syscall.SysProcAttr) {
+	attr.UseCgroupFD = true
+	attr.CgroupFD = int(g.dir.Fd())
+}
+
+// Usage reads what the run has consumed so far
+func (g *Cgroup) Usage() Usage {
+	var usage Usage
+	if data, err := os.ReadFile(filepath.Join(g.path, "memory.peak")); err == nil {
+		usage.PeakMemory, _ = strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+	}
+	if data, err := os.ReadFile(filepath.Join(g.path, "cpu.stat")); err == nil {
+		for _, line := range strings.Split(string(data), "\n") {
+			if value, ok := strings.CutPrefix(line, "usage_usec "); ok {
+				usec, _ := strconv.ParseInt(value, 10, 64)
+				usage.CPUTime = time.Duration(usec) * time.Microsecond
+			}
+		}
+	}
+	return usage
+}
+
+// Remove kills anything the run left behind in the cgroup and removes it
+func (g *Cgroup) Remove() error {
+	if g.dir != nil {
+		g.dir.Close()
+	}
+	writeCgroupFile(g.path, "cgroup.kill", "1")
+
+	// Removal fails until the killed processes are gone
+	var err error
+	for i := 0; i < 10; i++ {
+		if err = os.Remove(g.path); err == nil || os.IsNotExist(err) {
+			return nil
+		}
+		time.Sleep(groupPollInterval)
+	}
+	return err
+}
+
+// moveSelf moves the calling process out of the root cgroup into a leaf
+func (c *Cgroups) moveSelf(leaf string) error {
+	path := filepath.Join(c.root, leaf)
+	if err := os.Mkdir(path, 0755); err != nil && !os.IsExist(err) {
+		return err
+	}
+	return writeCgroupFile(path, "cgroup.procs", strconv.Itoa(os.Getpid()))
+}
+
+// probe starts a process in a throwaway leaf, which needs clone3 and so a
+// 5.7 or newer kernel
+func (c *Cgroups) probe() error {
+	g, err := c.Create(fmt.Sprintf("probe-%d", os.Getpid()), Limits{})
+	if err != nil {
+		return err
+	}
+	defer g.Remove()
+
+	cmd := exec.Command("true")
+	cmd.SysProcAttr = &syscall.SysProcAttr{}
+	g.Apply(cmd.SysProcAttr)
+	return cmd.Run()
+}
+
+// cgroup2Mount finds where the cgroup v2 hierarchy is mounted, which is
+// /sys/fs/cgroup on most systems and /sys/fs/cgroup/unified on hybrid ones
+func cgroup2Mount() (string, error) {
+	f, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// The filesystem type follows the " - " separator
+		fields := strings.Fields(scanner.Text())
+		for i, field := range fields {
+			if field == "-" && i+1 < len(fields) && fields[i+1] == "cgroup2" && len(fields) > 4 {
+				return fields[4], nil
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	return "", fmt.Errorf("no cgroup v2 hierarchy is mounted")
+}
+
+// ownCgroup returns the cgroup v2 path of the calling process
+func ownCgroup() (string, error) {
+	data, err := os.ReadFile("/proc/self/cgroup")
+	if err != nil {
+		return "", err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if path, ok := strings.CutPrefix(line, "0::"); ok {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("process is not in a cgroup v2 hierarchy")
+}
+
+func writeCgroupFile(dir, name, value string) error {
+	return os.WriteFile(filepath.Join(dir, name), []byte(value), 0644)
+}
@@ -0,0 +1,31 @@
+//go:build !linux
+
+package runner
+
+import (
+	"errors"
+	"syscall"
+)
+
+// Cgroups is only available on Linux
+type Cgroups struct{}
+
+// Cgroup is only available on Linux
+type Cgroup struct{}
+
+// OpenCgroups always fails outside Linux
+func OpenCgroups(root string) (*Cgroups, error) {
+	return nil, errors.New("cgroups need Linux")
+}
+
+func (c *Cgroups) Root() string { return "" }
+
+func (c *Cgroups) Create(name string, limits Limits) (*Cgroup, error) {
+	return nil, errors.New("cgroups need Linux")
+}
+
+func (g *Cgroup) Apply(attr *syscall.SysProcAttr) {}
+
+func (g *Cgroup) Usage() Usage { return Usage{} }
+
+func (g *Cgroup) Remove() error { return nil }
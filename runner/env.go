@@ -0,0 +1,140 @@
+package runner
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Environment modes: a run starts from antd's environment or from an
+// almost empty one
+const (
+	EnvInherit = "inherit"
+	EnvClear   = "clear"
+)
+
+// DefaultPath is the PATH of a run whose environment is cleared
+const DefaultPath = "/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"
+
+// ParseEnvVar checks a KEY=VALUE pair
+func ParseEnvVar(pair string) (key, value string, err error) {
+	key, value, ok := strings.Cut(pair, "=")
+	if !ok || !validEnvName(key) {
+		return "", "", fmt.Errorf("want KEY=VALUE, got %q", pair)
+	}
+	return key, value, nil
+}
+
+// ReadEnvFile reads KEY=VALUE lines from an .env style file. Blank lines,
+// # comments and a leading "export" are ignored. Values may be quoted:
+// single quotes keep everything as is, double quotes allow \n, \", \\ and
+// \$ escapes.
+func ReadEnvFile(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var vars []string
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+
+		key, value, err := ParseEnvVar(line)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, n, err)
+		}
+		if value, err = unquoteEnvValue(value); err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, n, err)
+		}
+		vars = append(vars, key+"="+value)
+	}
+	return vars, scanner.Err()
+}
+
+// MergeEnv combines environments, later ones overriding earlier ones, and
+// keeps variables in the order they first appear
+func MergeEnv(envs ...[]string) []string {
+	index := make(map[string]int)
+	var merged []string
+	for _, env := range envs {
+		for _, pair := range env {
+			key, _, _ := strings.Cut(pair, "=")
+			if i, ok := index[key]; ok {
+				merged[i] = pair
+				continue
+			}
+			index[key] = len(merged)
+			merged = append(merged, pair)
+		}
+	}
+	return merged
+}
+
+// unquoteEnvValue strips the quotes from a value and, for double quotes,
+// expands escapes. Unquoted values lose a trailing # comment.
+func unquoteEnvValue(value string) (string, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return "", nil
+	}
+
+	quote := value[0]
+	if quote != '\'' && quote != '"' {
+		if i := strings.Index(value, " #"); i >= 0 {
+			value = strings.TrimSpace(value[:i])
+		}
+		return value, nil
+	}
+
+	end := strings.LastIndexByte(value, quote)
+	if end == 0 {
+		return "", fmt.Errorf("unterminated quote")
+	}
+	if rest := strings.TrimSpace(value[end+1:]); rest != "" && !strings.HasPrefix(rest, "#") {
+		return "", fmt.Errorf("unexpected text after quoted value")
+	}
+	value = value[1:end]
+	if quote == '\'' {
+		return value, nil
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] != '\\' || i+1 == len(value) {
+			b.WriteByte(value[i])
+			continue
+		}
+		i++
+		switch value[i] {
+		case 'n':
+			b.WriteByte('\n')
+		case '"', '\\', '$':
+			b.WriteByte(value[i])
+		default:
+			b.WriteByte('\\')
+			b.WriteByte(value[i])
+		}
+	}
+	return b.String(), nil
+}
+
+// validEnvName reports whether name is a shell variable name
+func validEnvName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, c := range name {
+		letter := c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+		if !letter && (i == 0 || c < '0' || c > '9') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,61 @@
+package runner
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestReadEnvFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".env")
+	content := `# database settings
+DB_HOST=localhost
+export DB_PORT=5432
+DB_NAME=app # trailing comment
+
+GREETING="hello \"world\"\n"
+RAW='$HOME stays \n as is'
+EMPTY=
+`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := ReadEnvFile(path)
+	if err != nil {
+		t.Fatalf("ReadEnvFile unexpected error: %v", err)
+	}
+	want := []string{
+		"DB_HOST=localhost",
+		"DB_PORT=5432",
+		"DB_NAME=app",
+		"GREETING=hello \"world\"\n",
+		`RAW=$HOME stays \n as is`,
+		"EMPTY=",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ReadEnvFile = %q, want %q", got, want)
+	}
+
+	for _, bad := range []string{"no equals sign", "1ST=x", "A-B=x", `QUOTED="open`, `QUOTED="a" b`} {
+		if err := os.WriteFile(path, []byte(bad+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ReadEnvFile(path); err == nil {
+			t.Errorf("ReadEnvFile of %q succeeded, want error", bad)
+		}
+	}
+}
+
+func TestMergeEnv(t *testing.T) {
+	got := MergeEnv(
+		[]string{"PATH=/bin", "HOME=/root", "LANG=C"},
+		[]string{"HOME=/home/app"},
+		[]string{"LANG=en_US.UTF-8", "ANT_JOB_ID=3"},
+	)
+	want := []string{"PATH=/bin", "HOME=/home/app", "LANG=en_US.UTF-8", "ANT_JOB_ID=3"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("MergeEnv = %q, want %q", got, want)
+	}
+}
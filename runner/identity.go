@@ -0,0 +1,227 @@
+package runner
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/user"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// Identity is the user and group a run executes as
+type Identity struct {
+	User   *user.User
+	Group  *user.Group // primary group of the run
+	groups []uint32    // supplementary groups
+}
+
+// LookupIdentity resolves a user given by name or ID. The run gets the
+// user's primary group unless group names another.
+func LookupIdentity(userName, groupName string) (*Identity, error) {
+	u, err := lookupUser(userName)
+	if err != nil {
+		return nil, err
+	}
+
+	gid := u.Gid
+	if groupName != "" {
+		g, err := lookupGroup(groupName)
+		if err != nil {
+			return nil, err
+		}
+		gid = g.Gid
+	}
+	g, err := user.LookupGroupId(gid)
+	if err != nil {
+		// A primary group without a name still works by ID
+		g = &user.Group{Gid: gid, Name: gid}
+	}
+
+	id := &Identity{User: u, Group: g}
+	gids, err := u.GroupIds()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list groups of %s: %v", u.Username, err)
+	}
+	for _, gid := range gids {
+		if n, err := strconv.ParseUint(gid, 10, 32); err == nil {
+			id.groups = append(id.groups, uint32(n))
+		}
+	}
+	return id, nil
+}
+
+// InGroup reports whether the user belongs to the run's group
+func (id *Identity) InGroup() bool {
+	if id.Group.Gid == id.User.Gid {
+		return true
+	}
+	gid, _ := strconv.ParseUint(id.Group.Gid, 10, 32)
+	return slices.Contains(id.groups, uint32(gid))
+}
+
+// IsCurrent reports whether the identity is that of the calling process
+func (id *Identity) IsCurrent() bool {
+	return id.User.Uid == strconv.Itoa(os.Getuid()) && id.Group.Gid == strconv.Itoa(os.Getgid())
+}
+
+// Credential returns the credential to start a process with as the identity
+func (id *Identity) Credential() *syscall.Credential {
+	uid, _ := strconv.ParseUint(id.User.Uid, 10, 32)
+	gid, _ := strconv.ParseUint(id.Group.Gid, 10, 32)
+	return &syscall.Credential{Uid: uint32(uid), Gid: uint32(gid), Groups: id.groups}
+}
+
+// Env returns the variables that describe the identity's user to a run
+func (id *Identity) Env() []string {
+	return []string{
+		"HOME=" + id.User.HomeDir,
+		"USER=" + id.User.Username,
+		"LOGNAME=" + id.User.Username,
+	}
+}
+
+func (id *Identity) String() string {
+	return id.User.Username + ":" + id.Group.Name
+}
+
+// CanRead checks that the identity's user could read path itself, going by
+// its permission bits, so a job can't be used to read files its user can't
+func (id *Identity) CanRead(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if id.User.Uid == "0" {
+		return nil
+	}
+
+	mode := info.Mode().Perm()
+	owner, group := fileOwner(info)
+	gid, _ := strconv.ParseUint(id.Group.Gid, 10, 32)
+	inGroup := uint32(gid) == group
+	for _, g := range id.groups {
+		inGroup = inGroup || g == group
+	}
+
+	switch {
+	case strconv.FormatUint(uint64(owner), 10) == id.User.Uid:
+		mode &= 0400
+	case inGroup:
+		mode &= 0040
+	default:
+		mode &= 0004
+	}
+	if mode == 0 {
+		return fmt.Errorf("%s cannot read %s", id.User.Username, path)
+	}
+	return nil
+}
+
+// fileOwner returns the user and group that own a file
+func fileOwner(info os.FileInfo) (uid, gid uint32) {
+	st := info.Sys().(*syscall.Stat_t)
+	return st.Uid, st.Gid
+}
+
+// RunAsPolicy says who may run jobs as other users. Anyone may run jobs as
+// themselves and root may run them as anyone; everything else needs a rule.
+type RunAsPolicy struct {
+	// rules maps a submitter, or %group for its members, to the users
+	// they may run jobs as; "*" stands for every user
+	rules map[string][]string
+}
+
+// LoadRunAsPolicy reads a policy file of lines such as
+//
+//	alice: deploy, www-data
+//	%ops: *
+//
+// An empty path gives the policy with no extra rules.
+func LoadRunAsPolicy(path string) (*RunAsPolicy, error) {
+	p := &RunAsPolicy{rules: make(map[string][]string)}
+	if path == "" {
+		return p, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		submitter, targets, ok := strings.Cut(line, ":")
+		submitter = strings.TrimSpace(submitter)
+		if !ok || submitter == "" || strings.ContainsAny(submitter, " \t") {
+			return nil, fmt.Errorf("%s:%d: want submitter: user, user", path, n)
+		}
+		for _, target := range strings.Split(targets, ",") {
+			if target = strings.TrimSpace(target); target != "" {
+				p.rules[submitter] = append(p.rules[submitter], target)
+			}
+		}
+	}
+	return p, scanner.Err()
+}
+
+// Allows checks whether submitter may run a job as id
+func (p *RunAsPolicy) Allows(submitter *user.User, id *Identity) error {
+	if submitter.Uid == "0" {
+		return nil
+	}
+	if !id.InGroup() {
+		return fmt.Errorf("%s is not a member of group %s", id.User.Username, id.Group.Name)
+	}
+	if submitter.Uid == id.User.Uid {
+		return nil
+	}
+
+	keys := []string{submitter.Username}
+	if gids, err := submitter.GroupIds(); err == nil {
+		for _, gid := range gids {
+			if g, err := user.LookupGroupId(gid); err == nil {
+				keys = append(keys, "%"+g.Name)
+			}
+		}
+	}
+	for _, key := range keys {
+		for _, target := range p.rules[key] {
+			if target == "*" || target == id.User.Username {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("%s may not run jobs as %s", submitter.Username, id.User.Username)
+}
+
+// lookupUser finds a user by name, or by ID if there is no such name
+func lookupUser(name string) (*user.User, error) {
+	u, err := user.Lookup(name)
+	if _, isID := strconv.Atoi(name); err != nil && isID == nil {
+		u, err = user.LookupId(name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unknown user %s", name)
+	}
+	return u, nil
+}
+
+// lookupGroup finds a group by name, or by ID if there is no such name
+func lookupGroup(name string) (*user.Group, error) {
+	g, err := user.LookupGroup(name)
+	if _, isID := strconv.Atoi(name); err != nil && isID == nil {
+		g, err = user.LookupGroupId(name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unknown group %s", name)
+	}
+	return g, nil
+}
@@ -0,0 +1,77 @@
+package runner
+
+import (
+	"os"
+	"os/user"
+	"path/filepath"
+	"testing"
+)
+
+func TestLookupIdentity(t *testing.T) {
+	for _, name := range []string{"root", "0"} {
+		id, err := LookupIdentity(name, "")
+		if err != nil {
+			t.Fatalf("LookupIdentity(%q) unexpected error: %v", name, err)
+		}
+		if id.User.Uid != "0" || id.Group.Gid != "0" || !id.InGroup() {
+			t.Errorf("LookupIdentity(%q) = %s, want root:root", name, id)
+		}
+	}
+	if _, err := LookupIdentity("no-such-user-here", ""); err == nil {
+		t.Error("LookupIdentity of an unknown user succeeded, want error")
+	}
+	if _, err := LookupIdentity("root", "no-such-group-here"); err == nil {
+		t.Error("LookupIdentity with an unknown group succeeded, want error")
+	}
+}
+
+func TestRunAsPolicy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "run-as")
+	rules := "# who may run jobs as whom\nalice: deploy, www-data\nbob: *  # trusted\n"
+	if err := os.WriteFile(path, []byte(rules), 0644); err != nil {
+		t.Fatal(err)
+	}
+	policy, err := LoadRunAsPolicy(path)
+	if err != nil {
+		t.Fatalf("LoadRunAsPolicy unexpected error: %v", err)
+	}
+
+	person := func(uid, name string) *user.User {
+		return &user.User{Uid: uid, Gid: uid, Username: name}
+	}
+	as := func(u *user.User, gid string) *Identity {
+		return &Identity{User: u, Group: &user.Group{Gid: gid, Name: "g" + gid}}
+	}
+	root, alice, bob, carol := person("0", "root"), person("2001", "alice"), person("2002", "bob"), person("2003", "carol")
+	deploy := person("2100", "deploy")
+
+	tests := []struct {
+		name      string
+		submitter *user.User
+		id        *Identity
+		want      bool
+	}{
+		{"root runs as anyone", root, as(carol, "2003"), true},
+		{"anyone runs as themselves", carol, as(carol, "2003"), true},
+		{"listed user", alice, as(deploy, "2100"), true},
+		{"unlisted user", alice, as(carol, "2003"), false},
+		{"wildcard", bob, as(deploy, "2100"), true},
+		{"no rules", carol, as(deploy, "2100"), false},
+		{"group the user is not in", carol, as(carol, "2100"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := policy.Allows(tt.submitter, tt.id)
+			if (err == nil) != tt.want {
+				t.Errorf("Allows(%s, %s) = %v, want allowed %v", tt.submitter.Username, tt.id, err, tt.want)
+			}
+		})
+	}
+
+	if err := os.WriteFile(path, []byte("alice deploy\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadRunAsPolicy(path); err == nil {
+		t.Error("LoadRunAsPolicy of a malformed line succeeded, want error")
+	}
+}
@@ -0,0 +1,90 @@
+package runner
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Limits are the cgroup v2 resource limits of a job. Zero leaves a resource
+// unlimited.
+type Limits struct {
+	CPUWeight int   // cpu.weight, 1-10000; the kernel default is 100
+	CPUQuota  int   // cpu.max as a percentage of one CPU, e.g. 150 for 1.5 CPUs
+	MemoryMax int64 // memory.max in bytes
+	PidsMax   int   // pids.max
+	IOWeight  int   // io.weight, 1-10000; the kernel default is 100
+}
+
+// Usage is what a run consumed, as measured by its cgroup. Zero means it
+// could not be measured.
+type Usage struct {
+	PeakMemory int64         // bytes
+	CPUTime    time.Duration // user and system time of every process in the run
+}
+
+// IsZero reports whether no limit is set
+func (l Limits) IsZero() bool {
+	return l == Limits{}
+}
+
+// Validate checks the limits against the ranges the kernel accepts
+func (l Limits) Validate() error {
+	switch {
+	case l.CPUWeight != 0 && (l.CPUWeight < 1 || l.CPUWeight > 10000):
+		return fmt.Errorf("cpu weight must be between 1 and 10000")
+	case l.CPUQuota < 0:
+		return fmt.Errorf("cpu quota cannot be negative")
+	case l.MemoryMax < 0:
+		return fmt.Errorf("memory max cannot be negative")
+	case l.PidsMax < 0:
+		return fmt.Errorf("pids max cannot be negative")
+	case l.IOWeight != 0 && (l.IOWeight < 1 || l.IOWeight > 10000):
+		return fmt.Errorf("io weight must be between 1 and 10000")
+	}
+	return nil
+}
+
+var byteUnits = []struct {
+	suffix string
+	size   int64
+}{
+	{"T", 1 << 40},
+	{"G", 1 << 30},
+	{"M", 1 << 20},
+	{"K", 1 << 10},
+}
+
+// ParseBytes parses a size such as "512M" or "2G", in powers of 1024, or a
+// plain number of bytes
+func ParseBytes(input string) (int64, error) {
+	s := strings.ToUpper(strings.TrimSpace(input))
+	s = strings.TrimSuffix(strings.TrimSuffix(s, "B"), "I")
+
+	size := int64(1)
+	for _, unit := range byteUnits {
+		if strings.HasSuffix(s, unit.suffix) {
+			s, size = strings.TrimSuffix(s, unit.suffix), unit.size
+			break
+		}
+	}
+
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 0 || n > (1<<62)/size {
+		return 0, fmt.Errorf("invalid size: %s", input)
+	}
+	return n * size, nil
+}
+
+// FormatBytes formats a size with the largest unit that keeps it readable,
+// e.g. "1.5G"
+func FormatBytes(n int64) string {
+	for _, unit := range byteUnits {
+		if n >= unit.size {
+			s := strconv.FormatFloat(float64(n)/float64(unit.size), 'f', 1, 64)
+			return strings.TrimSuffix(s, ".0") + unit.suffix
+		}
+	}
+	return strconv.FormatInt(n, 10) + "B"
+}
@@ -0,0 +1,63 @@
+package runner
+
+import "testing"
+
+func TestParseBytes(t *testing.T) {
+	tests := []struct {
+		input string
+		want  int64
+	}{
+		{"4096", 4096},
+		{"512K", 512 << 10},
+		{"512M", 512 << 20},
+		{"512mb", 512 << 20},
+		{"2G", 2 << 30},
+		{"2GiB", 2 << 30},
+		{"1T", 1 << 40},
+	}
+	for _, tt := range tests {
+		got, err := ParseBytes(tt.input)
+		if err != nil || got != tt.want {
+			t.Errorf("ParseBytes(%q) = %d, %v, want %d", tt.input, got, err, tt.want)
+		}
+	}
+
+	for _, input := range []string{"", "M", "-1G", "1.5G", "lots", "99999999999T"} {
+		if _, err := ParseBytes(input); err == nil {
+			t.Errorf("ParseBytes(%q) succeeded, want error", input)
+		}
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	tests := []struct {
+		n    int64
+		want string
+	}{
+		{512, "512B"},
+		{1536, "1.5K"},
+		{300 << 20, "300M"},
+		{3 << 29, "1.5G"},
+	}
+	for _, tt := range tests {
+		if got := FormatBytes(tt.n); got != tt.want {
+			t.Errorf("FormatBytes(%d) = %q, want %q", tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestLimitsValidate(t *testing.T) {
+	valid := []Limits{{}, {CPUWeight: 100, CPUQuota: 150, MemoryMax: 1 << 30, PidsMax: 64, IOWeight: 10000}}
+	for _, l := range valid {
+		if err := l.Validate(); err != nil {
+			t.Errorf("%+v.Validate() = %v, want nil", l, err)
+		}
+	}
+
+	invalid := []Limits{{CPUWeight: 10001}, {CPUQuota: -1}, {MemoryMax: -1}, {PidsMax: -1}, {IOWeight: -5}}
+	for _, l := range invalid {
+		if err := l.Validate(); err == nil {
+			t.Errorf("%+v.Validate() succeeded, want error", l)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package runner
+
+import "fmt"
+
+// Overlap selects what happens when a job's run comes due while an
+// earlier run of it is still going
+type Overlap int
+
+const (
+	Forbid  Overlap = iota // skip the new run
+	Queue                  // start the new run once the current one finishes
+	Replace                // stop the current run and start the new one
+	Allow                  // run side by side, up to a maximum number of runs
+)
+
+var overlapNames = [...]string{
+	Forbid:  "forbid",
+	Queue:   "queue",
+	Replace: "replace",
+	Allow:   "allow",
+}
+
+// ParseOverlap parses an overlap policy name
+func ParseOverlap(name string) (Overlap, error) {
+	for o, n := range overlapNames {
+		if n == name {
+			return Overlap(o), nil
+		}
+	}
+	return Forbid, fmt.Errorf("invalid overlap policy: %s (want forbid, queue, replace or allow)", name)
+}
+
+func (o Overlap) String() string {
+	if o < 0 || int(o) >= len(overlapNames) {
+		return fmt.Sprintf("Overlap(%d)", int(o))
+	}
+	return overlapNames[o]
+}
@@ -0,0 +1,15 @@
+package runner
+
+import "testing"
+
+func TestParseOverlap(t *testing.T) {
+	for _, o := range []Overlap{Forbid, Queue, Replace, Allow} {
+		got, err := ParseOverlap(o.String())
+		if err != nil || got != o {
+			t.Errorf("ParseOverlap(%q) = %v, %v, want %v", o.String(), got, err, o)
+		}
+	}
+	if _, err := ParseOverlap("sometimes"); err == nil {
+		t.Error("ParseOverlap(\"sometimes\") succeeded, want error")
+	}
+}
@@ -0,0 +1,74 @@
+package runner
+
+import (
+	"fmt"
+	"syscall"
+	"time"
+)
+
+// DefaultKillGrace is how long a job gets to exit after SIGTERM before it
+// is sent SIGKILL
+const DefaultKillGrace = 10 * time.Second
+
+const (
+	// groupPollInterval is how often StopGroup checks whether a group has exited
+	groupPollInterval = 100 * time.Millisecond
+
+	// killTimeout is how long StopGroup waits for a group to go after SIGKILL
+	killTimeout = 5 * time.Second
+)
+
+// GroupAttr returns process attributes that start a command as the leader
+// of a new process group, so it and everything it spawns can be signalled
+// together
+func GroupAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{Setpgid: true}
+}
+
+// StopGroup ends the process group pgid: SIGTERM first, then SIGKILL if
+// any of it is still running after grace. It fails if anything in the group
+// survives SIGKILL. The group leader must be reaped by its parent for the
+// group to count as gone.
+func StopGroup(pgid int, grace time.Duration) error {
+	if err := signalGroup(pgid, syscall.SIGTERM); err != nil {
+		return err
+	}
+	if waitGroup(pgid, grace) {
+		return nil
+	}
+
+	if err := signalGroup(pgid, syscall.SIGKILL); err != nil {
+		return err
+	}
+	if waitGroup(pgid, killTimeout) {
+		return nil
+	}
+	return fmt.Errorf("processes still running in group %d after SIGKILL", pgid)
+}
+
+// waitGroup waits up to timeout for the group pgid to exit and reports
+// whether it did
+func waitGroup(pgid int, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for GroupAlive(pgid) {
+		if !time.Now().Before(deadline) {
+			return false
+		}
+		time.Sleep(groupPollInterval)
+	}
+	return true
+}
+
+// GroupAlive reports whether any process is left in the group pgid
+func GroupAlive(pgid int) bool {
+	return syscall.Kill(-pgid, 0) != syscall.ESRCH
+}
+
+// signalGroup sends sig to every process in the group. A group that has
+// already gone is not an error.
+func signalGroup(pgid int, sig syscall.Signal) error {
+	if err := syscall.Kill(-pgid, sig); err != nil && err != syscall.ESRCH {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package runner
+
+import (
+	"os/exec"
+	"testing"
+	"time"
+)
+
+func TestStopGroup(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		grace  time.Duration
+		min    time.Duration
+	}{
+		// The subshell's sleep is in the group too and must not survive
+		{"exits on SIGTERM", "sleep 60 & wait", 5 * time.Second, 0},
+		{"ignores SIGTERM", "trap '' TERM; sleep 60 & wait; sleep 60", 300 * time.Millisecond, 300 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := exec.Command("bash", "-c", tt.script)
+			cmd.SysProcAttr = GroupAttr()
+			if err := cmd.Start(); err != nil {
+				t.Fatalf("start: %v", err)
+			}
+			pgid := cmd.Process.Pid
+			waited := make(chan struct{})
+			go func() {
+				cmd.Wait()
+				close(waited)
+			}()
+			time.Sleep(100 * time.Millisecond)
+
+			start := time.Now()
+			if err := StopGroup(pgid, tt.grace); err != nil {
+				t.Fatalf("StopGroup: %v", err)
+			}
+			elapsed := time.Since(start)
+
+			select {
+			case <-waited:
+			case <-time.After(2 * time.Second):
+				t.Fatal("group leader still running after StopGroup")
+			}
+			// After SIGKILL it waits up to killTimeout for the group to be
+			// reaped, however long a busy machine takes over it
+			if limit := tt.grace + killTimeout; elapsed < tt.min || elapsed > limit {
+				t.Errorf("StopGroup took %s, want between %s and %s", elapsed, tt.min, limit)
+			}
+
+			if GroupAlive(pgid) {
+				t.Error("processes left in the group after StopGroup")
+			}
+		})
+	}
+}
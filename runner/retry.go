@@ -0,0 +1,103 @@
+package runner
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RetryPolicy decides whether and when a failed run is attempted again
+type RetryPolicy struct {
+	MaxAttempts int           // total attempts per run; 1 or less means no retries
+	Delay       time.Duration // wait before the second attempt
+	Backoff     float64       // multiplier applied to the wait for each further attempt
+	Jitter      float64       // random spread of each wait, as a fraction of it (0-1)
+	ExitCodes   []int         // exit codes worth retrying; empty means any failure
+}
+
+// DefaultBackoff doubles the wait between attempts
+const DefaultBackoff = 2.0
+
+// Validate checks the policy for values that make no sense
+func (p RetryPolicy) Validate() error {
+	switch {
+	case p.MaxAttempts < 1:
+		return fmt.Errorf("max attempts must be at least 1")
+	case p.Delay < 0:
+		return fmt.Errorf("retry delay cannot be negative")
+	case p.Backoff < 1:
+		return fmt.Errorf("retry backoff must be at least 1")
+	case p.Jitter < 0 || p.Jitter > 1:
+		return fmt.Errorf("retry jitter must be between 0 and 1")
+	}
+	return nil
+}
+
+// ShouldRetry reports whether a run that just finished as attempt number
+// attempt with the given status and exit code gets another attempt
+func (p RetryPolicy) ShouldRetry(attempt int, status string, exitCode int) bool {
+	if status == "ok" || attempt >= p.MaxAttempts {
+		return false
+	}
+	if len(p.ExitCodes) == 0 {
+		return true
+	}
+	// Runs killed by a signal have no exit code to match
+	for _, code := range p.ExitCodes {
+		if status == "failed" && code == exitCode {
+			return true
+		}
+	}
+	return false
+}
+
+// NextDelay returns how long to wait after the given attempt failed
+func (p RetryPolicy) NextDelay(attempt int) time.Duration {
+	return p.delay(attempt, rand.Float64())
+}
+
+// delay computes the wait after attempt, with r in [0, 1) choosing where
+// in the jitter range it falls
+func (p RetryPolicy) delay(attempt int, r float64) time.Duration {
+	backoff := p.Backoff
+	if backoff < 1 {
+		backoff = 1
+	}
+	wait := float64(p.Delay) * math.Pow(backoff, float64(attempt-1))
+	wait += wait * p.Jitter * (2*r - 1)
+
+	// Guard against overflowing time.Duration with silly settings
+	if wait > float64(math.MaxInt64) {
+		return time.Duration(math.MaxInt64)
+	}
+	return time.Duration(wait)
+}
+
+// ParseExitCodes parses a comma separated list of exit codes such as "1,75"
+func ParseExitCodes(input string) ([]int, error) {
+	if strings.TrimSpace(input) == "" {
+		return nil, nil
+	}
+
+	var codes []int
+	for _, field := range strings.Split(input, ",") {
+		code, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil || code < 0 || code > 255 {
+			return nil, fmt.Errorf("invalid exit code: %s", field)
+		}
+		codes = append(codes, code)
+	}
+	return codes, nil
+}
+
+// FormatExitCodes is the inverse of ParseExitCodes
+func FormatExitCodes(codes []int) string {
+	fields := make([]string, len(codes))
+	for i, code := range codes {
+		fields[i] = strconv.Itoa(code)
+	}
+	return strings.Join(fields, ",")
+}
@@ -0,0 +1,84 @@
+package runner
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestShouldRetry(t *testing.T) {
+	any := RetryPolicy{MaxAttempts: 3}
+	some := RetryPolicy{MaxAttempts: 3, ExitCodes: []int{1, 75}}
+
+	tests := []struct {
+		name     string
+		policy   RetryPolicy
+		attempt  int
+		status   string
+		exitCode int
+		want     bool
+	}{
+		{"success is final", any, 1, "ok", 0, false},
+		{"no retries configured", RetryPolicy{MaxAttempts: 1}, 1, "failed", 1, false},
+		{"any failure", any, 1, "failed", 2, true},
+		{"killed", any, 2, "killed", -1, true},
+		{"timeout", any, 1, "timeout", -1, true},
+		{"attempts used up", any, 3, "failed", 1, false},
+		{"listed exit code", some, 1, "failed", 75, true},
+		{"unlisted exit code", some, 1, "failed", 2, false},
+		{"killed with exit codes listed", some, 1, "killed", -1, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.ShouldRetry(tt.attempt, tt.status, tt.exitCode); got != tt.want {
+				t.Errorf("ShouldRetry(%d, %s, %d) = %v, want %v", tt.attempt, tt.status, tt.exitCode, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDelay(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 5, Delay: 10 * time.Second, Backoff: 2, Jitter: 0.5}
+
+	tests := []struct {
+		attempt int
+		r       float64
+		want    time.Duration
+	}{
+		{1, 0.5, 10 * time.Second},
+		{2, 0.5, 20 * time.Second},
+		{3, 0.5, 40 * time.Second},
+		{1, 0, 5 * time.Second},
+		{2, 0.75, 25 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := policy.delay(tt.attempt, tt.r); got != tt.want {
+			t.Errorf("delay(%d, %v) = %s, want %s", tt.attempt, tt.r, got, tt.want)
+		}
+	}
+
+	for i := 0; i < 100; i++ {
+		if got := policy.NextDelay(2); got < 10*time.Second || got > 30*time.Second {
+			t.Fatalf("NextDelay(2) = %s, want within 10s-30s", got)
+		}
+	}
+}
+
+func TestParseExitCodes(t *testing.T) {
+	codes, err := ParseExitCodes("1, 75,255")
+	if err != nil || !reflect.DeepEqual(codes, []int{1, 75, 255}) {
+		t.Errorf("ParseExitCodes = %v, %v", codes, err)
+	}
+	if FormatExitCodes(codes) != "1,75,255" {
+		t.Errorf("FormatExitCodes = %q", FormatExitCodes(codes))
+	}
+	if codes, err := ParseExitCodes(""); err != nil || codes != nil {
+		t.Errorf("ParseExitCodes(\"\") = %v, %v", codes, err)
+	}
+	for _, input := range []string{"x", "1,,2", "256", "-1"} {
+		if _, err := ParseExitCodes(input); err == nil {
+			t.Errorf("ParseExitCodes(%q) succeeded, want error", input)
+		}
+	}
+}
@@ -0,0 +1,3 @@
+// Package runner holds the rules for running a job's process that ant and
+// antd share: how it is supervised and what happens when it fails.
+package runner
@@ -0,0 +1,206 @@
+package schedule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronMacros maps the supported @ shorthands to their 5-field expression.
+// @reboot is handled separately since it has no calendar time.
+var cronMacros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+var monthNames = map[string]int{
+	"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+	"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+}
+
+var dowNames = map[string]int{
+	"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+}
+
+// cronSearchDays bounds how far ahead next looks for a match. Five years
+// is enough to reach the next Feb 29.
+const cronSearchDays = 366 * 5
+
+// cronSpec is a parsed 5-field cron expression, each field a bitset of the
+// values it matches
+type cronSpec struct {
+	minute, hour, dom, month, dow uint64
+	domStar, dowStar              bool
+}
+
+// cronField describes the allowed range and names of one cron field
+type cronField struct {
+	name     string
+	min, max int
+	names    map[string]int
+}
+
+var cronFields = [5]cronField{
+	{"minute", 0, 59, nil},
+	{"hour", 0, 23, nil},
+	{"day of month", 1, 31, nil},
+	{"month", 1, 12, monthNames},
+	{"day of week", 0, 7, dowNames},
+}
+
+// parseCron parses a standard 5-field cron expression
+func parseCron(expr string) (*cronSpec, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("invalid cron expression: %s", expr)
+	}
+
+	var bits [5]uint64
+	for i, field := range fields {
+		b, err := parseCronField(field, cronFields[i])
+		if err != nil {
+			return nil, err
+		}
+		bits[i] = b
+	}
+
+	// 7 is an alias for Sunday
+	if bits[4]&(1<<7) != 0 {
+		bits[4] = bits[4]&^(1<<7) | 1
+	}
+
+	spec := &cronSpec{
+		minute:  bits[0],
+		hour:    bits[1],
+		dom:     bits[2],
+		month:   bits[3],
+		dow:     bits[4],
+		domStar: strings.HasPrefix(fields[2], "*"),
+		dowStar: strings.HasPrefix(fields[4], "*"),
+	}
+
+	// Reject expressions like "0 0 31 feb *" that can never fire
+	if spec.next(time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)).IsZero() {
+		return nil, fmt.Errorf("cron expression never matches: %s", expr)
+	}
+	return spec, nil
+}
+
+// parseCronField parses a comma separated list of values, ranges and steps
+// (5, 1-5, */15, 9-17/2, mon-fri) into a bitset
+func parseCronField(field string, f cronField) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rangePart, step := part, 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("invalid step in %s field: %s", f.name, part)
+			}
+			rangePart, step = part[:i], n
+		}
+
+		var lo, hi int
+		switch {
+		case rangePart == "*":
+			lo, hi = f.min, f.max
+			if f.name == "day of week" {
+				hi = 6
+			}
+		case strings.Contains(rangePart, "-"):
+			bounds := strings.SplitN(rangePart, "-", 2)
+			var err error
+			if lo, err = parseCronValue(bounds[0], f); err != nil {
+				return 0, err
+			}
+			if hi, err = parseCronValue(bounds[1], f); err != nil {
+				return 0, err
+			}
+			if lo > hi {
+				return 0, fmt.Errorf("invalid range in %s field: %s", f.name, part)
+			}
+		default:
+			v, err := parseCronValue(rangePart, f)
+			if err != nil {
+				return 0, err
+			}
+			lo, hi = v, v
+			// "5/15" means starting at 5, every 15
+			if step > 1 {
+				hi = f.max
+			}
+		}
+
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+// parseCronValue parses a single numeric or named value of a cron field
+func parseCronValue(s string, f cronField) (int, error) {
+	if v, ok := f.names[strings.ToLower(s)]; ok {
+		return v, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil || v < f.min || v > f.max {
+		return 0, fmt.Errorf("invalid %s: %s", f.name, s)
+	}
+	return v, nil
+}
+
+// matchDay reports whether the calendar day of t satisfies the day of month,
+// month and day of week fields. As in cron, when both day fields are
+// restricted a day matching either one is enough.
+func (c *cronSpec) matchDay(t time.Time) bool {
+	if c.month&(1<<uint(t.Month())) == 0 {
+		return false
+	}
+	domMatch := c.dom&(1<<uint(t.Day())) != 0
+	dowMatch := c.dow&(1<<uint(t.Weekday())) != 0
+	if c.domStar || c.dowStar {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
+
+// next returns the first minute strictly after now that matches the
+// expression, or the zero time if there is none within cronSearchDays
+func (c *cronSpec) next(now time.Time) time.Time {
+	after := now.Truncate(time.Minute).Add(time.Minute)
+	loc := now.Location()
+
+	// Days are stepped at noon so a DST change at midnight can't skip one
+	day := time.Date(after.Year(), after.Month(), after.Day(), 12, 0, 0, 0, loc)
+
+	// Hours well before after on its own day can't match. The one just
+	// before is still tried, since a DST jump may move its times past after.
+	firstHour := after.Hour() - 1
+	for i := 0; i < cronSearchDays; i++ {
+		if c.matchDay(day) {
+			for h := 0; h < 24; h++ {
+				if c.hour&(1<<uint(h)) == 0 || (i == 0 && h < firstHour) {
+					continue
+				}
+				for m := 0; m < 60; m++ {
+					if c.minute&(1<<uint(m)) == 0 {
+						continue
+					}
+					candidate := wallClock(day.Year(), day.Month(), day.Day(), h, m, loc)
+					if !candidate.Before(after) {
+						return candidate
+					}
+				}
+			}
+		}
+		day = time.Date(day.Year(), day.Month(), day.Day()+1, 12, 0, 0, 0, loc)
+	}
+	return time.Time{}
+}
@@ -0,0 +1,171 @@
+package schedule
+
+import "time"
+
+// MisfirePolicy selects what happens to runs that were missed, typically
+// because antd was not running when they were due
+type MisfirePolicy int
+
+const (
+	RunOnce MisfirePolicy = iota // run once for all missed runs
+	Skip                         // drop missed runs and wait for the next one
+	RunAll                       // run every missed run in turn, up to MisfireCap
+)
+
+const (
+	// DefaultMisfireCap bounds how many missed runs RunAll catches up on
+	DefaultMisfireCap = 10
+
+	// LateTolerance is how long after its scheduled time a run may start and
+	// still count as on time rather than missed
+	LateTolerance = time.Minute
+
+	// maxMissedCount bounds how many missed calendar runs are counted one
+	// by one; past it Plan.Skipped is only a lower bound
+	maxMissedCount = 10000
+)
+
+// Plan is the decision for a job whose run at some scheduled time is due
+type Plan struct {
+	Run       bool      // start the job now
+	Scheduled time.Time // the scheduled time the started run stands in for
+	Skipped   int       // number of missed runs given up on
+	Uncounted bool      // more were missed than Skipped, too many to count
+	Next      time.Time // new next run; zero if there is none
+}
+
+// PlanRun decides what to do with a job that was scheduled to run at
+// scheduled and is being looked at now. A single run reached within
+// LateTolerance just runs. Otherwise every due run counts as missed and the
+// misfire policy applies; missed runs older than the grace window, if one
+// is set, are always skipped.
+func PlanRun(s *Schedule, scheduled, now time.Time) Plan {
+	due := s.dueRuns(scheduled, now)
+	plan := Plan{Next: s.following(due.recent[len(due.recent)-1], now)}
+
+	// The common case: the daemon was up and got to the run in time
+	if due.count == 1 && now.Sub(scheduled) <= LateTolerance {
+		plan.Run = true
+		plan.Scheduled = scheduled
+		return plan
+	}
+
+	// Only the newest missed runs can still be inside the grace window
+	eligible := due.recent
+	if s.Grace > 0 {
+		for len(eligible) > 0 && now.Sub(eligible[0]) > s.Grace {
+			eligible = eligible[1:]
+		}
+	}
+
+	var run []time.Time
+	switch s.Misfire {
+	case RunOnce:
+		if len(eligible) > 0 {
+			run = eligible[len(eligible)-1:]
+		}
+	case RunAll:
+		run = eligible
+	}
+
+	plan.Skipped = due.count - len(run)
+	plan.Uncounted = due.uncounted
+	if len(run) > 0 {
+		plan.Run = true
+		plan.Scheduled = run[0]
+		if len(run) > 1 {
+			// The daemon picks the rest up one at a time
+			plan.Next = run[1]
+		}
+	}
+	return plan
+}
+
+// dueRuns lists the runs from scheduled up to now
+type dueRuns struct {
+	count     int         // number of due runs
+	uncounted bool        // count is a lower bound
+	recent    []time.Time // the newest of them, oldest first
+}
+
+// dueRuns collects the runs of s that are due at now, starting at scheduled.
+// Only as many as could be caught up on are kept.
+func (s *Schedule) dueRuns(scheduled, now time.Time) dueRuns {
+	keep := 1
+	if s.Misfire == RunAll {
+		keep = s.misfireCap()
+	}
+
+	due := dueRuns{count: 1, recent: []time.Time{scheduled}}
+	if s.Type != Repeating || s.AtReboot || s.Manual || s.Mode == FixedDelay || !now.After(scheduled) {
+		return due
+	}
+
+	// Fixed-rate intervals are evenly spaced, so they can be counted
+	if s.IsInterval {
+		n := int64(now.Sub(scheduled) / s.Interval)
+		due.count = int(n + 1)
+		due.recent = due.recent[:0]
+		for k := max(0, n-int64(keep)+1); k <= n; k++ {
+			due.recent = append(due.recent, scheduled.Add(time.Duration(k)*s.Interval))
+		}
+		return due
+	}
+
+	// Calendar schedules have to be walked. Find the newest runs first, by
+	// looking back from now over a window that doubles until it holds
+	// enough of them or reaches scheduled.
+	var from time.Time
+	var inWindow int
+	for lookback := time.Hour; ; lookback *= 2 {
+		from = now.Add(-lookback)
+		reached := !from.After(scheduled)
+		due.recent, inWindow = due.recent[:0], 0
+		if reached {
+			from = scheduled
+			due.recent, inWindow = append(due.recent, scheduled), 1
+		}
+		for t := NextRunAfter(s, from, from); !t.IsZero() && !t.After(now); t = NextRunAfter(s, t, t) {
+			inWindow++
+			due.recent = append(due.recent, t)
+			if len(due.recent) > keep {
+				due.recent = due.recent[1:]
+			}
+		}
+		if reached {
+			due.count = inWindow
+			return due
+		}
+		if inWindow >= keep {
+			break
+		}
+	}
+
+	// Then count the older runs, which can only be skipped
+	due.count = inWindow + 1
+	for t := NextRunAfter(s, scheduled, scheduled); !t.IsZero() && !t.After(from); t = NextRunAfter(s, t, t) {
+		if due.count >= maxMissedCount {
+			due.uncounted = true
+			break
+		}
+		due.count++
+	}
+	return due
+}
+
+// following returns the first run after last that is in the future, or
+// zero for one-shot, @reboot and @manual schedules
+func (s *Schedule) following(last, now time.Time) time.Time {
+	if s.Type != Repeating || s.AtReboot || s.Manual {
+		return time.Time{}
+	}
+	return NextRunAfter(s, last, now)
+}
+
+// misfireCap returns the configured cap or the default
+func (s *Schedule) misfireCap() int {
+	if s.MisfireCap > 0 {
+		return s.MisfireCap
+	}
+	return DefaultMisfireCap
+}
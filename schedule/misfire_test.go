@@ -0,0 +1,157 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPlanRun(t *testing.T) {
+	// Wednesday 2026-10-14 12:00:00 UTC
+	base := time.Date(2026, time.October, 14, 12, 0, 0, 0, time.UTC)
+	at := func(d time.Duration) time.Time { return base.Add(d) }
+
+	tests := []struct {
+		name      string
+		input     string
+		scheduled time.Time
+		now       time.Time
+		want      Plan
+	}{
+		{
+			name:      "on time",
+			input:     "e 1h",
+			scheduled: base,
+			now:       at(time.Second),
+			want:      Plan{Run: true, Scheduled: base, Next: at(time.Hour)},
+		},
+		{
+			name:      "late within tolerance",
+			input:     "misfire=skip e 1h",
+			scheduled: base,
+			now:       at(30 * time.Second),
+			want:      Plan{Run: true, Scheduled: base, Next: at(time.Hour)},
+		},
+		{
+			name:      "run once for a day of missed runs",
+			input:     "e 1h",
+			scheduled: base,
+			now:       at(24*time.Hour + 30*time.Minute),
+			want:      Plan{Run: true, Scheduled: at(24 * time.Hour), Skipped: 24, Next: at(25 * time.Hour)},
+		},
+		{
+			name:      "skip missed runs",
+			input:     "misfire=skip e 1h",
+			scheduled: base,
+			now:       at(3*time.Hour + 30*time.Minute),
+			want:      Plan{Skipped: 4, Next: at(4 * time.Hour)},
+		},
+		{
+			name:      "skip a single late run",
+			input:     "misfire=skip e 1h",
+			scheduled: base,
+			now:       at(10 * time.Minute),
+			want:      Plan{Skipped: 1, Next: at(time.Hour)},
+		},
+		{
+			name:      "run all missed runs one at a time",
+			input:     "misfire=run-all-missed e 1h",
+			scheduled: base,
+			now:       at(2*time.Hour + 30*time.Minute),
+			want:      Plan{Run: true, Scheduled: base, Next: at(time.Hour)},
+		},
+		{
+			name:      "run all keeps only the newest up to the cap",
+			input:     "misfire=run-all misfire-cap=2 e 1h", // the short spelling
+			scheduled: base,
+			now:       at(4*time.Hour + 30*time.Minute),
+			want:      Plan{Run: true, Scheduled: at(3 * time.Hour), Skipped: 3, Next: at(4 * time.Hour)},
+		},
+		{
+			name:      "run all on the last missed run",
+			input:     "misfire=run-all-missed e 1h",
+			scheduled: at(2 * time.Hour),
+			now:       at(2*time.Hour + 30*time.Minute),
+			want:      Plan{Run: true, Scheduled: at(2 * time.Hour), Next: at(3 * time.Hour)},
+		},
+		{
+			name:      "grace skips runs that are too old",
+			input:     "misfire=run-all-missed grace=90m e 1h",
+			scheduled: base,
+			now:       at(3*time.Hour + 30*time.Minute),
+			want:      Plan{Run: true, Scheduled: at(2 * time.Hour), Skipped: 2, Next: at(3 * time.Hour)},
+		},
+		{
+			name:      "grace with nothing left to run",
+			input:     "grace=10m e 1h",
+			scheduled: base,
+			now:       at(30 * time.Minute),
+			want:      Plan{Skipped: 1, Next: at(time.Hour)},
+		},
+		{
+			name:      "one-shot run late",
+			input:     "2026-10-14T12:00Z",
+			scheduled: base,
+			now:       at(48 * time.Hour),
+			want:      Plan{Run: true, Scheduled: base},
+		},
+		{
+			name:      "one-shot outside grace",
+			input:     "grace=1h 2026-10-14T12:00Z",
+			scheduled: base,
+			now:       at(2 * time.Hour),
+			want:      Plan{Skipped: 1},
+		},
+		{
+			name:      "cron missed runs",
+			input:     "misfire=skip 0 9 * * *",
+			scheduled: base.Add(-3 * time.Hour),
+			now:       at(3 * 24 * time.Hour),
+			want:      Plan{Skipped: 4, Next: time.Date(2026, time.October, 18, 9, 0, 0, 0, time.UTC)},
+		},
+		{
+			name:      "fixed delay only ever has one due run",
+			input:     "mode=delay misfire=skip e 1h",
+			scheduled: base,
+			now:       at(5 * time.Hour),
+			want:      Plan{Skipped: 1, Next: at(6 * time.Hour)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := ParseAt(tt.input, tt.now)
+			if err != nil {
+				t.Fatalf("ParseAt(%q) unexpected error: %v", tt.input, err)
+			}
+			got := PlanRun(s, tt.scheduled, tt.now)
+			if got.Run != tt.want.Run || !got.Scheduled.Equal(tt.want.Scheduled) ||
+				got.Skipped != tt.want.Skipped || !got.Next.Equal(tt.want.Next) {
+				t.Errorf("PlanRun(%q) = %+v, want %+v", tt.input, got, tt.want)
+			}
+		})
+	}
+
+	// Long outages are counted without stepping through every missed run
+	month := 30 * 24 * time.Hour
+	s, _ := ParseAt("e 1s", base)
+	if got := PlanRun(s, base, at(month)); !got.Run || !got.Scheduled.Equal(at(month)) ||
+		got.Skipped != int(month/time.Second) || got.Uncounted {
+		t.Errorf("PlanRun(e 1s) after a month = %+v", got)
+	}
+	s, _ = ParseAt("misfire=run-all-missed misfire-cap=3 * * * * *", base)
+	got := PlanRun(s, base, at(month+30*time.Second))
+	if !got.Run || !got.Scheduled.Equal(at(month-2*time.Minute)) || !got.Next.Equal(at(month-time.Minute)) ||
+		got.Skipped < maxMissedCount-3 || !got.Uncounted {
+		t.Errorf("PlanRun(* * * * *) after a month = %+v", got)
+	}
+	s, _ = ParseAt("misfire=skip 30 * * * *", base)
+	if got := PlanRun(s, base, at(month)); got.Skipped != 30*24+1 || got.Uncounted {
+		t.Errorf("PlanRun(30 * * * *) after a month = %+v, want %d skipped", got, 30*24+1)
+	}
+
+	for _, input := range []string{"misfire=never e 1h", "misfire-cap=0 e 1h", "grace=soon e 1h"} {
+		if _, err := Parse(input); err == nil {
+			t.Errorf("Parse(%q) succeeded, want error", input)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package schedule
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// setOption applies one leading key=value option of a schedule
+func (s *Schedule) setOption(key, value string) error {
+	switch key {
+	case "TZ", "CRON_TZ":
+		loc, err := time.LoadLocation(value)
+		if err != nil || value == "" {
+			return fmt.Errorf("invalid time zone: %s", value)
+		}
+		s.Location = loc
+
+	case "mode":
+		switch value {
+		case "rate":
+			s.Mode = FixedRate
+		case "delay":
+			s.Mode = FixedDelay
+		default:
+			return fmt.Errorf("invalid mode: %s (want rate or delay)", value)
+		}
+
+	case "misfire":
+		switch value {
+		case "run-once":
+			s.Misfire = RunOnce
+		case "skip":
+			s.Misfire = Skip
+		case "run-all-missed", "run-all":
+			s.Misfire = RunAll
+		default:
+			return fmt.Errorf("invalid misfire policy: %s (want skip, run-once or run-all-missed)", value)
+		}
+
+	case "misfire-cap":
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			return fmt.Errorf("invalid misfire-cap: %s", value)
+		}
+		s.MisfireCap = n
+
+	case "grace":
+		d, err := parseInterval(value)
+		if err != nil {
+			return fmt.Errorf("invalid grace: %s", value)
+		}
+		s.Grace = d
+
+	default:
+		return fmt.Errorf("unknown schedule option: %s", key)
+	}
+	return nil
+}
@@ -0,0 +1,516 @@
+// Package schedule implements the schedule grammar shared by ant and antd.
+//
+// A schedule is an optional "e " prefix (repeat every time) followed by
+// either an interval or a set of weekdays and times of day:
+//
+//	15m, 2h, 1d, 1w, 1h30m    run once after (or every) interval
+//	mon 0930, fri 17:00       run once on (or every) weekday at time
+//	mon,wed,fri 0900          lists of days
+//	mon-fri 0800,1700         day ranges and lists of times
+//	weekdays, weekends        aliases for mon-fri and sat,sun
+//
+// One-shot schedules may also name an absolute time, which cannot repeat:
+//
+//	2026-11-02T03:00          ISO 8601, with optional seconds and offset
+//	2026-11-02 0300           date and time of day
+//	tomorrow 0300, today 1800 relative day and time of day
+//	+2h30m                    offset from now
+//
+// A schedule may start with key=value options:
+//
+//	TZ=<zone>, CRON_TZ=<zone> resolve wall-clock times in an IANA zone
+//	mode=rate, mode=delay     space repeating intervals from the previous
+//	                          run's scheduled time (default) or its completion
+//	misfire=run-once          catch up on missed runs with a single run
+//	                          (default),
+//	misfire=skip              drop them,
+//	misfire=run-all-missed    or run each of them in turn (also run-all)
+//	misfire-cap=N             catch up on at most N missed runs (default 10)
+//	grace=<duration>          skip missed runs that are older than this
+//
+// With TZ= wall-clock times are resolved in that zone instead of the local
+// one. Across DST transitions a time that falls in a skipped hour fires at
+// the moment the clocks jump forward, and a time in a repeated hour fires
+// once, on its first occurrence. Intervals count elapsed time and ignore
+// DST.
+//
+// Standard 5-field cron expressions and the @ macros are also accepted and
+// always repeat:
+//
+//	*/5 9-17 * * mon-fri      every 5 minutes during working hours
+//	@hourly, @daily, @weekly  shorthands for the usual cron expressions
+//	@reboot                   every time antd starts
+//	@manual                   only when triggered, such as by a dependency
+package schedule
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Type represents the type of schedule
+type Type int
+
+const (
+	SingleRun Type = iota
+	Repeating
+)
+
+// Mode selects how the runs of a repeating interval are spaced
+type Mode int
+
+const (
+	FixedRate  Mode = iota // every interval, anchored to the first run
+	FixedDelay             // interval after the previous run completes
+)
+
+// Schedule represents a parsed schedule
+type Schedule struct {
+	Type       Type
+	Interval   time.Duration  // for interval-based schedules (15m, 1h, etc)
+	Weekdays   []time.Weekday // for weekday-based schedules, in week order
+	Times      []time.Time    // for specific time schedules, sorted; only hour and minute are used
+	IsInterval bool           // true if this is an interval-based schedule
+	AtReboot   bool           // true for @reboot, which has no calendar time
+	Manual     bool           // true for @manual, which only runs when triggered
+	At         time.Time      // for absolute one-shot schedules
+	Location   *time.Location // zone from a TZ= prefix, nil for local time
+	Mode       Mode           // spacing of repeating intervals
+	Misfire    MisfirePolicy  // what to do with missed runs
+	MisfireCap int            // how many missed runs RunAll catches up on, 0 for the default
+	Grace      time.Duration  // how late a missed run may still be caught up, 0 for no limit
+
+	cron *cronSpec // for cron expressions and macros
+}
+
+// Parse parses schedule strings into a Schedule struct
+func Parse(input string) (*Schedule, error) {
+	return ParseAt(input, time.Now())
+}
+
+// ParseAt parses schedule strings into a Schedule struct, resolving relative
+// absolute times (tomorrow 0300, +2h) against now
+func ParseAt(input string, now time.Time) (*Schedule, error) {
+	input = strings.TrimSpace(input)
+	schedule := &Schedule{}
+
+	// Leading key=value options apply to everything that follows
+	for {
+		first, rest, _ := strings.Cut(input, " ")
+		key, value, ok := strings.Cut(first, "=")
+		if !ok {
+			break
+		}
+		if err := schedule.setOption(key, value); err != nil {
+			return nil, err
+		}
+		input = strings.TrimSpace(rest)
+	}
+	if schedule.Location != nil {
+		now = now.In(schedule.Location)
+	}
+
+	if err := schedule.parseTiming(input, now); err != nil {
+		return nil, err
+	}
+
+	if schedule.Mode == FixedDelay && (schedule.Type != Repeating || !schedule.IsInterval) {
+		return nil, fmt.Errorf("mode=delay requires a repeating interval")
+	}
+	return schedule, nil
+}
+
+// parseTiming parses the part of a schedule after its options
+func (s *Schedule) parseTiming(input string, now time.Time) error {
+	// Check if it's a repeating schedule
+	if strings.HasPrefix(input, "e ") {
+		s.Type = Repeating
+		input = strings.TrimSpace(strings.TrimPrefix(input, "e "))
+	} else {
+		s.Type = SingleRun
+	}
+
+	if at, ok, err := parseAbsolute(input, now); ok {
+		if err != nil {
+			return err
+		}
+		if s.Type == Repeating {
+			return fmt.Errorf("absolute time cannot repeat: %s", input)
+		}
+		s.At = at
+		return nil
+	}
+
+	// Cron expressions and macros always repeat
+	if input == "@reboot" {
+		s.Type = Repeating
+		s.AtReboot = true
+		return nil
+	}
+	if input == "@manual" {
+		s.Type = Repeating
+		s.Manual = true
+		return nil
+	}
+	if expr, ok := cronMacros[input]; ok {
+		input = expr
+	}
+	if len(strings.Fields(input)) == 5 {
+		spec, err := parseCron(input)
+		if err != nil {
+			return err
+		}
+		s.Type = Repeating
+		s.cron = spec
+		return nil
+	}
+
+	// Try to parse as an interval (15m, 1h, etc)
+	if duration, err := parseInterval(input); err == nil {
+		s.Interval = duration
+		s.IsInterval = true
+		return nil
+	}
+
+	// Split remaining input into day and time parts
+	parts := strings.Fields(input)
+	if len(parts) != 2 {
+		return fmt.Errorf("invalid schedule format: %s", input)
+	}
+
+	days, err := parseWeekdays(parts[0])
+	if err != nil {
+		return err
+	}
+	s.Weekdays = days
+
+	times, err := parseTimesOfDay(parts[1])
+	if err != nil {
+		return err
+	}
+	s.Times = times
+
+	return nil
+}
+
+// intervalUnits maps the single-letter interval suffixes to their duration
+var intervalUnits = map[string]time.Duration{
+	"s": time.Second,
+	"m": time.Minute,
+	"h": time.Hour,
+	"d": time.Hour * 24,
+	"w": time.Hour * 24 * 7,
+}
+
+// parseInterval handles duration-based schedules (15m, 1d, 1h30m, etc)
+func parseInterval(input string) (time.Duration, error) {
+	if len(input) > 1 {
+		if unit, ok := intervalUnits[input[len(input)-1:]]; ok {
+			if n, err := strconv.Atoi(input[:len(input)-1]); err == nil && n > 0 {
+				return time.Duration(n) * unit, nil
+			}
+		}
+	}
+
+	// Fall back to Go duration syntax for compound intervals like 1h30m
+	if d, err := time.ParseDuration(input); err == nil && d > 0 {
+		return d, nil
+	}
+
+	return 0, fmt.Errorf("invalid interval format: %s", input)
+}
+
+// absoluteLayouts are the accepted ISO 8601 forms, tried in order. Layouts
+// without an offset are interpreted in the local time zone.
+var absoluteLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02",
+}
+
+// parseAbsolute recognises absolute one-shot times. ok is false if input is
+// not written as an absolute time at all, so other forms can be tried.
+func parseAbsolute(input string, now time.Time) (at time.Time, ok bool, err error) {
+	if strings.HasPrefix(input, "+") {
+		d, err := parseInterval(input[1:])
+		if err != nil {
+			return time.Time{}, true, fmt.Errorf("invalid offset: %s", input)
+		}
+		return now.Add(d), true, nil
+	}
+
+	parts := strings.Fields(input)
+	if len(parts) == 2 {
+		var day time.Time
+		switch strings.ToLower(parts[0]) {
+		case "today":
+			day = now
+		case "tomorrow":
+			day = now.AddDate(0, 0, 1)
+		default:
+			d, err := time.ParseInLocation("2006-01-02", parts[0], now.Location())
+			if err != nil {
+				return time.Time{}, false, nil
+			}
+			day = d
+		}
+
+		tod, err := parseTimeOfDay(parts[1])
+		if err != nil {
+			return time.Time{}, true, err
+		}
+		return wallClock(day.Year(), day.Month(), day.Day(),
+			tod.Hour(), tod.Minute(), now.Location()), true, nil
+	}
+
+	if len(parts) == 1 && len(input) >= 10 && input[4] == '-' {
+		for _, layout := range absoluteLayouts {
+			if t, err := time.ParseInLocation(layout, input, now.Location()); err == nil {
+				if !strings.HasSuffix(layout, "Z07:00") {
+					t = wallClock(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), now.Location()).
+						Add(time.Duration(t.Second()) * time.Second)
+				}
+				return t, true, nil
+			}
+		}
+		return time.Time{}, true, fmt.Errorf("invalid date and time: %s", input)
+	}
+
+	return time.Time{}, false, nil
+}
+
+// weekdays maps the accepted day names to time.Weekday
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "sunday": time.Sunday,
+	"mon": time.Monday, "monday": time.Monday,
+	"tue": time.Tuesday, "tuesday": time.Tuesday,
+	"wed": time.Wednesday, "wednesday": time.Wednesday,
+	"thu": time.Thursday, "thursday": time.Thursday,
+	"fri": time.Friday, "friday": time.Friday,
+	"sat": time.Saturday, "saturday": time.Saturday,
+}
+
+// weekdayAliases maps named day groups to the days they cover
+var weekdayAliases = map[string][]time.Weekday{
+	"weekdays": {time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday},
+	"weekends": {time.Saturday, time.Sunday},
+}
+
+// parseWeekday converts day string to time.Weekday
+func parseWeekday(day string) (time.Weekday, error) {
+	if weekday, ok := weekdays[strings.ToLower(day)]; ok {
+		return weekday, nil
+	}
+	return 0, fmt.Errorf("invalid weekday: %s", day)
+}
+
+// parseWeekdays parses a comma separated list of days, day ranges (mon-fri,
+// fri-mon) and aliases (weekdays, weekends) into a sorted set of weekdays
+func parseWeekdays(input string) ([]time.Weekday, error) {
+	var set [7]bool
+	for _, item := range strings.Split(input, ",") {
+		if alias, ok := weekdayAliases[strings.ToLower(item)]; ok {
+			for _, day := range alias {
+				set[day] = true
+			}
+			continue
+		}
+
+		if from, to, ok := strings.Cut(item, "-"); ok {
+			start, err := parseWeekday(from)
+			if err != nil {
+				return nil, err
+			}
+			end, err := parseWeekday(to)
+			if err != nil {
+				return nil, err
+			}
+			// Ranges may wrap around the end of the week
+			for day := start; ; day = (day + 1) % 7 {
+				set[day] = true
+				if day == end {
+					break
+				}
+			}
+			continue
+		}
+
+		day, err := parseWeekday(item)
+		if err != nil {
+			return nil, err
+		}
+		set[day] = true
+	}
+
+	var days []time.Weekday
+	for day, ok := range set {
+		if ok {
+			days = append(days, time.Weekday(day))
+		}
+	}
+	return days, nil
+}
+
+// parseTimeOfDay parses a time string (HHMM or HH:MM) into a time.Time
+// holding only the hour and minute
+func parseTimeOfDay(timeStr string) (time.Time, error) {
+	clean := timeStr
+	if len(timeStr) == 5 && timeStr[2] == ':' {
+		clean = timeStr[:2] + timeStr[3:]
+	}
+	if len(clean) != 4 {
+		return time.Time{}, fmt.Errorf("invalid time format: %s", timeStr)
+	}
+
+	hour, err := strconv.Atoi(clean[:2])
+	if err != nil || hour < 0 || hour > 23 {
+		return time.Time{}, fmt.Errorf("invalid hour: %s", clean[:2])
+	}
+
+	minute, err := strconv.Atoi(clean[2:])
+	if err != nil || minute < 0 || minute > 59 {
+		return time.Time{}, fmt.Errorf("invalid minute: %s", clean[2:])
+	}
+
+	return time.Date(0, time.January, 1, hour, minute, 0, 0, time.UTC), nil
+}
+
+// parseTimesOfDay parses a comma separated list of times into a sorted,
+// de-duplicated slice
+func parseTimesOfDay(input string) ([]time.Time, error) {
+	var times []time.Time
+	for _, item := range strings.Split(input, ",") {
+		t, err := parseTimeOfDay(item)
+		if err != nil {
+			return nil, err
+		}
+		times = append(times, t)
+	}
+
+	sort.Slice(times, func(i, j int) bool { return times[i].Before(times[j]) })
+	unique := times[:1]
+	for _, t := range times[1:] {
+		if !t.Equal(unique[len(unique)-1]) {
+			unique = append(unique, t)
+		}
+	}
+	return unique, nil
+}
+
+// NextRunAfter determines the run that follows one scheduled at previous,
+// as seen at now. Fixed-rate intervals stay anchored to previous and step
+// whole intervals until the result is after now, so they neither drift nor
+// pile up. Fixed-delay intervals count from now, which callers should pass
+// as the completion time of the previous run. Other schedules return their
+// first slot after both previous and now.
+func NextRunAfter(schedule *Schedule, previous, now time.Time) time.Time {
+	if schedule.IsInterval && schedule.Type == Repeating && !previous.IsZero() {
+		if schedule.Mode == FixedDelay {
+			return now.Add(schedule.Interval)
+		}
+		next := previous.Add(schedule.Interval)
+		if next.After(now) {
+			return next
+		}
+		missed := now.Sub(previous) / schedule.Interval
+		return previous.Add((missed + 1) * schedule.Interval)
+	}
+
+	from := now
+	if !previous.Before(now) {
+		from = previous.Add(time.Second)
+	}
+	return CalculateNextRun(schedule, from)
+}
+
+// CalculateNextRun determines when the job should next run after now. It
+// returns the zero time for @reboot schedules, which antd runs on startup
+// instead, and for @manual ones, which never come due. Absolute schedules
+// always return their fixed time, even once it has passed; callers adding
+// a job should reject those.
+func CalculateNextRun(schedule *Schedule, now time.Time) time.Time {
+	if schedule.Location != nil {
+		now = now.In(schedule.Location)
+	}
+
+	if schedule.AtReboot || schedule.Manual {
+		return time.Time{}
+	}
+
+	if !schedule.At.IsZero() {
+		return schedule.At
+	}
+
+	if schedule.cron != nil {
+		return schedule.cron.next(now)
+	}
+
+	if schedule.IsInterval {
+		return now.Add(schedule.Interval)
+	}
+
+	// Walk forward a day at a time; within a week plus a day every
+	// matching weekday has been seen, including today's later slots
+	for offset := 0; offset <= 7; offset++ {
+		day := time.Date(now.Year(), now.Month(), now.Day()+offset, 12, 0, 0, 0, now.Location())
+		if !schedule.onWeekday(day.Weekday()) {
+			continue
+		}
+		for _, t := range schedule.Times {
+			result := wallClock(
+				day.Year(), day.Month(), day.Day(),
+				t.Hour(), t.Minute(),
+				now.Location(),
+			)
+			if !result.Before(now) {
+				return result
+			}
+		}
+	}
+
+	return time.Time{}
+}
+
+// onWeekday reports whether the schedule includes the given weekday
+func (s *Schedule) onWeekday(day time.Weekday) bool {
+	for _, d := range s.Weekdays {
+		if d == day {
+			return true
+		}
+	}
+	return false
+}
+
+// wallClock returns the instant at which the clock in loc shows the given
+// date, hour and minute. Unlike time.Date it resolves DST transitions
+// deterministically: a time skipped by a forward jump maps to the instant of
+// the jump, and a time that occurs twice maps to its first occurrence.
+func wallClock(year int, month time.Month, day, hour, minute int, loc *time.Location) time.Time {
+	t := time.Date(year, month, day, hour, minute, 0, 0, loc)
+
+	start, end := t.ZoneBounds()
+	if t.Hour() != hour || t.Minute() != minute {
+		// The wall time does not exist; time.Date has normalised it to one
+		// side of the gap, so the jump is the nearer zone boundary
+		if !end.IsZero() && (start.IsZero() || end.Sub(t) < t.Sub(start)) {
+			return end
+		}
+		return start
+	}
+
+	// If the clocks went back shortly before t, the same wall time may
+	// already have been shown once in the previous zone
+	if !start.IsZero() {
+		_, offset := t.Zone()
+		_, prevOffset := start.Add(-time.Second).Zone()
+		if shift := time.Duration(prevOffset-offset) * time.Second; shift > 0 && t.Sub(start) < shift {
+			return t.Add(-shift)
+		}
+	}
+	return t
+}
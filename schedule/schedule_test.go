@@ -0,0 +1,389 @@
+package schedule
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		input     string
+		want      Schedule
+		wantTimes string
+		wantErr   bool
+	}{
+		{input: "15m", want: Schedule{Type: SingleRun, Interval: 15 * time.Minute, IsInterval: true}},
+		{input: "e 15m", want: Schedule{Type: Repeating, Interval: 15 * time.Minute, IsInterval: true}},
+		{input: "e 30s", want: Schedule{Type: Repeating, Interval: 30 * time.Second, IsInterval: true}},
+		{input: "e 1d", want: Schedule{Type: Repeating, Interval: 24 * time.Hour, IsInterval: true}},
+		{input: "e 1w", want: Schedule{Type: Repeating, Interval: 7 * 24 * time.Hour, IsInterval: true}},
+		{input: "e 1h30m", want: Schedule{Type: Repeating, Interval: 90 * time.Minute, IsInterval: true}},
+		{input: "  e  2h ", want: Schedule{Type: Repeating, Interval: 2 * time.Hour, IsInterval: true}},
+		{input: "e mon 0930", want: Schedule{Type: Repeating, Weekdays: []time.Weekday{time.Monday}}, wantTimes: "09:30"},
+		{input: "e mon 09:30", want: Schedule{Type: Repeating, Weekdays: []time.Weekday{time.Monday}}, wantTimes: "09:30"},
+		{input: "fri 1700", want: Schedule{Type: SingleRun, Weekdays: []time.Weekday{time.Friday}}, wantTimes: "17:00"},
+		{input: "e Sunday 0000", want: Schedule{Type: Repeating, Weekdays: []time.Weekday{time.Sunday}}, wantTimes: "00:00"},
+		{input: "e mon,wed,fri 0900", want: Schedule{Type: Repeating, Weekdays: []time.Weekday{time.Monday, time.Wednesday, time.Friday}}, wantTimes: "09:00"},
+		{input: "e weekdays 1700,0800", want: Schedule{Type: Repeating, Weekdays: []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday}}, wantTimes: "08:00,17:00"},
+		{input: "e weekends 12:00", want: Schedule{Type: Repeating, Weekdays: []time.Weekday{time.Sunday, time.Saturday}}, wantTimes: "12:00"},
+		{input: "e fri-mon 0600", want: Schedule{Type: Repeating, Weekdays: []time.Weekday{time.Sunday, time.Monday, time.Friday, time.Saturday}}, wantTimes: "06:00"},
+		{input: "e mon-wed,sat 0900,0900", want: Schedule{Type: Repeating, Weekdays: []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Saturday}}, wantTimes: "09:00"},
+		{input: "*/5 9-17 * * mon-fri", want: Schedule{Type: Repeating}},
+		{input: "e 0 3 * * *", want: Schedule{Type: Repeating}},
+		{input: "@hourly", want: Schedule{Type: Repeating}},
+		{input: "@daily", want: Schedule{Type: Repeating}},
+		{input: "@reboot", want: Schedule{Type: Repeating, AtReboot: true}},
+		{input: "@manual", want: Schedule{Type: Repeating, Manual: true}},
+		{input: "", wantErr: true},
+		{input: "@sometimes", wantErr: true},
+		{input: "60 * * * *", wantErr: true},
+		{input: "* 24 * * *", wantErr: true},
+		{input: "* * 0 * *", wantErr: true},
+		{input: "* * * 13 *", wantErr: true},
+		{input: "* * * * 8", wantErr: true},
+		{input: "*/0 * * * *", wantErr: true},
+		{input: "5-1 * * * *", wantErr: true},
+		{input: "0 0 31 feb *", wantErr: true},
+		{input: "* * * * * *", wantErr: true},
+		{input: "e", wantErr: true},
+		{input: "0m", wantErr: true},
+		{input: "-5m", wantErr: true},
+		{input: "e mon", wantErr: true},
+		{input: "e mon 2400", wantErr: true},
+		{input: "e mon 0960", wantErr: true},
+		{input: "e mon 930", wantErr: true},
+		{input: "e mon 0:930", wantErr: true},
+		{input: "e funday 0930", wantErr: true},
+		{input: "e mon 0930 extra", wantErr: true},
+		{input: "e mon,,fri 0930", wantErr: true},
+		{input: "e mon-funday 0930", wantErr: true},
+		{input: "e mon 0930,", wantErr: true},
+		{input: "e mon 0930,2500", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := Parse(tt.input)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("Parse(%q) = %+v, want error", tt.input, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse(%q) unexpected error: %v", tt.input, err)
+			}
+			if got.Type != tt.want.Type || got.Interval != tt.want.Interval ||
+				got.IsInterval != tt.want.IsInterval || got.AtReboot != tt.want.AtReboot ||
+				got.Manual != tt.want.Manual ||
+				!reflect.DeepEqual(got.Weekdays, tt.want.Weekdays) {
+				t.Errorf("Parse(%q) = %+v, want %+v", tt.input, got, tt.want)
+			}
+			var times []string
+			for _, tod := range got.Times {
+				times = append(times, tod.Format("15:04"))
+			}
+			if strings.Join(times, ",") != tt.wantTimes {
+				t.Errorf("Parse(%q) times = %v, want %s", tt.input, times, tt.wantTimes)
+			}
+		})
+	}
+}
+
+func TestCalculateNextRun(t *testing.T) {
+	// Wednesday 2026-10-14 12:00:00 UTC
+	now := time.Date(2026, time.October, 14, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		input string
+		want  time.Time
+	}{
+		{"e 15m", now.Add(15 * time.Minute)},
+		{"1d", now.Add(24 * time.Hour)},
+		{"e wed 1300", time.Date(2026, time.October, 14, 13, 0, 0, 0, time.UTC)},
+		{"e wed 1200", now},
+		{"e wed 1100", time.Date(2026, time.October, 21, 11, 0, 0, 0, time.UTC)},
+		{"e thu 0000", time.Date(2026, time.October, 15, 0, 0, 0, 0, time.UTC)},
+		{"e mon 0930", time.Date(2026, time.October, 19, 9, 30, 0, 0, time.UTC)},
+		{"tue 23:59", time.Date(2026, time.October, 20, 23, 59, 0, 0, time.UTC)},
+		{"e mon,wed,fri 0900", time.Date(2026, time.October, 16, 9, 0, 0, 0, time.UTC)},
+		{"e mon,wed,fri 0900,1230", time.Date(2026, time.October, 14, 12, 30, 0, 0, time.UTC)},
+		{"e weekdays 0800,1700", time.Date(2026, time.October, 14, 17, 0, 0, 0, time.UTC)},
+		{"e weekdays 0800,1100", time.Date(2026, time.October, 15, 8, 0, 0, 0, time.UTC)},
+		{"e weekends 0800", time.Date(2026, time.October, 17, 8, 0, 0, 0, time.UTC)},
+		{"e sun-tue 1000", time.Date(2026, time.October, 18, 10, 0, 0, 0, time.UTC)},
+		{"*/5 9-17 * * mon-fri", time.Date(2026, time.October, 14, 12, 5, 0, 0, time.UTC)},
+		{"*/5 9-17 * * sat,sun", time.Date(2026, time.October, 17, 9, 0, 0, 0, time.UTC)},
+		{"0 9-17 * * *", time.Date(2026, time.October, 14, 13, 0, 0, 0, time.UTC)},
+		{"30 2 * * *", time.Date(2026, time.October, 15, 2, 30, 0, 0, time.UTC)},
+		{"0 0 1 * *", time.Date(2026, time.November, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 feb *", time.Date(2028, time.February, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 12 * * 7", time.Date(2026, time.October, 18, 12, 0, 0, 0, time.UTC)},
+		{"0 0 13 * fri", time.Date(2026, time.October, 16, 0, 0, 0, 0, time.UTC)},
+		{"0 0 13 * *", time.Date(2026, time.November, 13, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * */2", time.Date(2026, time.October, 15, 0, 0, 0, 0, time.UTC)},
+		{"15/20 * * * *", time.Date(2026, time.October, 14, 12, 15, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2026, time.October, 14, 13, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2026, time.October, 15, 0, 0, 0, 0, time.UTC)},
+		{"@weekly", time.Date(2026, time.October, 18, 0, 0, 0, 0, time.UTC)},
+		{"@reboot", time.Time{}},
+		{"@manual", time.Time{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			s, err := Parse(tt.input)
+			if err != nil {
+				t.Fatalf("Parse(%q) unexpected error: %v", tt.input, err)
+			}
+			if got := CalculateNextRun(s, now); !got.Equal(tt.want) {
+				t.Errorf("CalculateNextRun(%q) = %s, want %s", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseAbsolute(t *testing.T) {
+	// Wednesday 2026-10-14 12:00:00 UTC
+	now := time.Date(2026, time.October, 14, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		input   string
+		want    time.Time
+		wantErr bool
+	}{
+		{input: "2026-11-02T03:00", want: time.Date(2026, time.November, 2, 3, 0, 0, 0, time.UTC)},
+		{input: "2026-11-02T03:00:30", want: time.Date(2026, time.November, 2, 3, 0, 30, 0, time.UTC)},
+		{input: "2026-11-02T03:00:00Z", want: time.Date(2026, time.November, 2, 3, 0, 0, 0, time.UTC)},
+		{input: "2026-11-02T03:00+02:00", want: time.Date(2026, time.November, 2, 1, 0, 0, 0, time.UTC)},
+		{input: "2026-11-02", want: time.Date(2026, time.November, 2, 0, 0, 0, 0, time.UTC)},
+		{input: "2026-11-02 0300", want: time.Date(2026, time.November, 2, 3, 0, 0, 0, time.UTC)},
+		{input: "2026-11-02 03:00", want: time.Date(2026, time.November, 2, 3, 0, 0, 0, time.UTC)},
+		{input: "tomorrow 0300", want: time.Date(2026, time.October, 15, 3, 0, 0, 0, time.UTC)},
+		{input: "today 1800", want: time.Date(2026, time.October, 14, 18, 0, 0, 0, time.UTC)},
+		{input: "+2h30m", want: now.Add(150 * time.Minute)},
+		{input: "+1d", want: now.Add(24 * time.Hour)},
+		{input: "2020-01-01T00:00", want: time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)},
+		{input: "e 2026-11-02T03:00", wantErr: true},
+		{input: "e tomorrow 0300", wantErr: true},
+		{input: "2026-13-02T03:00", wantErr: true},
+		{input: "2026-11-02T3am", wantErr: true},
+		{input: "tomorrow 3am", wantErr: true},
+		{input: "+soon", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseAt(tt.input, now)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ParseAt(%q) = %+v, want error", tt.input, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseAt(%q) unexpected error: %v", tt.input, err)
+			}
+			if got.Type != SingleRun {
+				t.Errorf("ParseAt(%q) type = %v, want SingleRun", tt.input, got.Type)
+			}
+			if next := CalculateNextRun(got, now); !next.Equal(tt.want) {
+				t.Errorf("CalculateNextRun(%q) = %s, want %s", tt.input, next, tt.want)
+			}
+		})
+	}
+}
+
+func TestTimeZones(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// In 2026 New York springs forward at 02:00 on Mar 8 and falls back at
+	// 02:00 on Nov 1; Berlin falls back at 03:00 on Oct 25
+	tests := []struct {
+		name  string
+		input string
+		now   time.Time
+		want  time.Time
+	}{
+		{
+			name:  "zone applies to weekday times",
+			input: "TZ=America/New_York e weekdays 0900",
+			now:   time.Date(2026, time.October, 14, 12, 0, 0, 0, time.UTC),
+			want:  time.Date(2026, time.October, 14, 13, 0, 0, 0, time.UTC),
+		},
+		{
+			name:  "zone decides the day",
+			input: "TZ=America/New_York e wed 2300",
+			now:   time.Date(2026, time.October, 15, 2, 0, 0, 0, time.UTC),
+			want:  time.Date(2026, time.October, 15, 3, 0, 0, 0, time.UTC),
+		},
+		{
+			name:  "CRON_TZ applies to cron",
+			input: "CRON_TZ=Europe/Berlin 0 9 * * *",
+			now:   time.Date(2026, time.October, 14, 12, 0, 0, 0, time.UTC),
+			want:  time.Date(2026, time.October, 15, 7, 0, 0, 0, time.UTC),
+		},
+		{
+			name:  "zone applies to absolute times",
+			input: "TZ=Europe/Berlin 2026-11-02T03:00",
+			now:   time.Date(2026, time.October, 14, 12, 0, 0, 0, time.UTC),
+			want:  time.Date(2026, time.November, 2, 2, 0, 0, 0, time.UTC),
+		},
+		{
+			name:  "explicit offset wins over zone",
+			input: "TZ=Europe/Berlin 2026-11-02T03:00Z",
+			now:   time.Date(2026, time.October, 14, 12, 0, 0, 0, time.UTC),
+			want:  time.Date(2026, time.November, 2, 3, 0, 0, 0, time.UTC),
+		},
+		{
+			name:  "skipped time fires at the jump",
+			input: "TZ=America/New_York e sun 0230",
+			now:   time.Date(2026, time.March, 7, 12, 0, 0, 0, newYork),
+			want:  time.Date(2026, time.March, 8, 3, 0, 0, 0, newYork),
+		},
+		{
+			name:  "skipped cron slots collapse into one run",
+			input: "TZ=America/New_York */15 2 * * *",
+			now:   time.Date(2026, time.March, 8, 3, 0, 0, 0, newYork),
+			want:  time.Date(2026, time.March, 9, 2, 0, 0, 0, newYork),
+		},
+		{
+			name:  "skipped absolute time fires at the jump",
+			input: "TZ=America/New_York 2026-03-08 0215",
+			now:   time.Date(2026, time.March, 1, 0, 0, 0, 0, newYork),
+			want:  time.Date(2026, time.March, 8, 7, 0, 0, 0, time.UTC),
+		},
+		{
+			name:  "repeated time fires on first occurrence",
+			input: "TZ=America/New_York e sun 0130",
+			now:   time.Date(2026, time.October, 31, 12, 0, 0, 0, newYork),
+			want:  time.Date(2026, time.November, 1, 5, 30, 0, 0, time.UTC),
+		},
+		{
+			name:  "repeated time does not fire twice",
+			input: "TZ=America/New_York e sun 0130",
+			now:   time.Date(2026, time.November, 1, 5, 31, 0, 0, time.UTC),
+			want:  time.Date(2026, time.November, 8, 6, 30, 0, 0, time.UTC),
+		},
+		{
+			name:  "repeated cron hour is not run twice",
+			input: "TZ=America/New_York 59 1 * * *",
+			now:   time.Date(2026, time.November, 1, 5, 59, 30, 0, time.UTC),
+			want:  time.Date(2026, time.November, 2, 6, 59, 0, 0, time.UTC),
+		},
+		{
+			name:  "cron resumes after the repeated hour",
+			input: "TZ=Europe/Berlin */30 * * * *",
+			now:   time.Date(2026, time.October, 25, 0, 45, 0, 0, time.UTC),
+			want:  time.Date(2026, time.October, 25, 3, 0, 0, 0, berlin),
+		},
+		{
+			name:  "intervals count elapsed time",
+			input: "TZ=America/New_York e 1d",
+			now:   time.Date(2026, time.March, 7, 12, 0, 0, 0, newYork),
+			want:  time.Date(2026, time.March, 8, 13, 0, 0, 0, newYork),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := ParseAt(tt.input, tt.now)
+			if err != nil {
+				t.Fatalf("ParseAt(%q) unexpected error: %v", tt.input, err)
+			}
+			if got := CalculateNextRun(s, tt.now); !got.Equal(tt.want) {
+				t.Errorf("CalculateNextRun(%q, %s) = %s, want %s", tt.input, tt.now, got, tt.want.In(got.Location()))
+			}
+		})
+	}
+
+	for _, input := range []string{"TZ=Mars/Olympus e 1h", "TZ= e 1h"} {
+		if _, err := Parse(input); err == nil {
+			t.Errorf("Parse(%q) succeeded, want error", input)
+		}
+	}
+}
+
+func TestNextRunAfter(t *testing.T) {
+	// Wednesday 2026-10-14 12:00:00 UTC
+	now := time.Date(2026, time.October, 14, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		input    string
+		previous time.Time
+		now      time.Time
+		want     time.Time
+	}{
+		{
+			name:     "fixed rate is anchored to the previous run",
+			input:    "e 15m",
+			previous: now,
+			now:      now.Add(3 * time.Second),
+			want:     now.Add(15 * time.Minute),
+		},
+		{
+			name:     "fixed rate skips whole missed intervals",
+			input:    "e 15m",
+			previous: now,
+			now:      now.Add(50 * time.Minute),
+			want:     now.Add(60 * time.Minute),
+		},
+		{
+			name:     "fixed rate on an exact boundary moves on",
+			input:    "mode=rate e 15m",
+			previous: now,
+			now:      now.Add(30 * time.Minute),
+			want:     now.Add(45 * time.Minute),
+		},
+		{
+			name:     "fixed delay counts from completion",
+			input:    "mode=delay e 15m",
+			previous: now,
+			now:      now.Add(7 * time.Minute),
+			want:     now.Add(22 * time.Minute),
+		},
+		{
+			name:     "calendar schedules use the next slot",
+			input:    "e wed 1200",
+			previous: now,
+			now:      now,
+			want:     now.AddDate(0, 0, 7),
+		},
+		{
+			name:     "cron uses the next slot after now",
+			input:    "0 * * * *",
+			previous: now,
+			now:      now.Add(5 * time.Second),
+			want:     now.Add(time.Hour),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := ParseAt(tt.input, now)
+			if err != nil {
+				t.Fatalf("ParseAt(%q) unexpected error: %v", tt.input, err)
+			}
+			if got := NextRunAfter(s, tt.previous, tt.now); !got.Equal(tt.want) {
+				t.Errorf("NextRunAfter(%q) = %s, want %s", tt.input, got, tt.want)
+			}
+		})
+	}
+
+	for _, input := range []string{"mode=delay 15m", "mode=delay e mon 0900", "mode=fast e 15m", "retries=3 e 15m"} {
+		if _, err := Parse(input); err == nil {
+			t.Errorf("Parse(%q) succeeded, want error", input)
+		}
+	}
+}
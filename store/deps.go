@@ -0,0 +1,178 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Querier is what *sql.DB and *sql.Tx have in common, so the helpers here
+// can run inside a caller's transaction
+type Querier interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// Dependency modes, stored in jobs.deps_mode
+const (
+	DepsAll = "all" // run once every dependency has succeeded
+	DepsAny = "any" // run whenever any dependency succeeds
+)
+
+// AddDeps records that jobID runs after each job in dependsOn succeeds. It
+// fails if one of them does not exist or the new edges would close a cycle.
+func AddDeps(q Querier, jobID int, dependsOn []int) error {
+	for _, dep := range dependsOn {
+		var exists bool
+		if err := q.QueryRow("SELECT EXISTS (SELECT 1 FROM jobs WHERE id = ?)", dep).Scan(&exists); err != nil {
+			return err
+		}
+		if !exists {
+			return fmt.Errorf("job %d not found", dep)
+		}
+	}
+
+	graph, err := Deps(q)
+	if err != nil {
+		return err
+	}
+	graph[jobID] = append(graph[jobID], dependsOn...)
+	if cycle := findCycle(graph); cycle != nil {
+		return fmt.Errorf("dependency cycle: %s", formatPath(cycle))
+	}
+
+	for _, dep := range dependsOn {
+		_, err := q.Exec("INSERT OR IGNORE INTO job_deps (job_id, depends_on) VALUES (?, ?)", jobID, dep)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Deps returns the dependency graph: for every job that has dependencies,
+// the jobs it runs after, in ID order
+func Deps(q Querier) (map[int][]int, error) {
+	rows, err := q.Query("SELECT job_id, depends_on FROM job_deps ORDER BY job_id, depends_on")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	graph := make(map[int][]int)
+	for rows.Next() {
+		var jobID, dep int
+		if err := rows.Scan(&jobID, &dep); err != nil {
+			return nil, err
+		}
+		graph[jobID] = append(graph[jobID], dep)
+	}
+	return graph, rows.Err()
+}
+
+// SatisfyDeps records that jobID has succeeded and returns the jobs that
+// should run as a result: those that need any one of their dependencies,
+// and those that need all of them once the last one has succeeded. The
+// dependencies of every job returned start over as unsatisfied.
+func SatisfyDeps(db *sql.DB, jobID int) ([]int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("UPDATE job_deps SET satisfied = 1 WHERE depends_on = ?", jobID); err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.Query(`
+		SELECT d.job_id FROM job_deps d JOIN jobs j ON j.id = d.job_id
+		WHERE d.depends_on = ? AND (j.deps_mode = ? OR NOT EXISTS (
+			SELECT 1 FROM job_deps o WHERE o.job_id = d.job_id AND o.satisfied = 0))
+		ORDER BY d.job_id`,
+		jobID, DepsAny,
+	)
+	if err != nil {
+		return nil, err
+	}
+	var ready []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ready = append(ready, id)
+	}
+	rows.Close()
+
+	for _, id := range ready {
+		if _, err := tx.Exec("UPDATE job_deps SET satisfied = 0 WHERE job_id = ?", id); err != nil {
+			return nil, err
+		}
+	}
+	return ready, tx.Commit()
+}
+
+// findCycle returns a cycle in graph as the jobs along it, with the first
+// repeated at the end, or nil if there is none
+func findCycle(graph map[int][]int) []int {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make(map[int]int)
+	var path []int
+
+	var visit func(n int) []int
+	visit = func(n int) []int {
+		state[n] = visiting
+		path = append(path, n)
+		for _, next := range graph[n] {
+			switch state[next] {
+			case visiting:
+				// The cycle is the part of the path from next onwards
+				for i, p := range path {
+					if p == next {
+						return append(append([]int{}, path[i:]...), next)
+					}
+				}
+			case unvisited:
+				if cycle := visit(next); cycle != nil {
+					return cycle
+				}
+			}
+		}
+		path = path[:len(path)-1]
+		state[n] = visited
+		return nil
+	}
+
+	// Visit in ID order so the same graph always reports the same cycle
+	ids := make([]int, 0, len(graph))
+	for id := range graph {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	for _, id := range ids {
+		if state[id] == unvisited {
+			if cycle := visit(id); cycle != nil {
+				return cycle
+			}
+		}
+	}
+	return nil
+}
+
+// formatPath formats a list of job IDs as "1 -> 2 -> 3"
+func formatPath(ids []int) string {
+	parts := make([]string, len(ids))
+	for i, id := range ids {
+		parts[i] = strconv.Itoa(id)
+	}
+	return strings.Join(parts, " -> ")
+}
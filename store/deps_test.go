@@ -0,0 +1,111 @@
+package store
+
+import (
+	"database/sql"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFindCycle(t *testing.T) {
+	tests := []struct {
+		name  string
+		graph map[int][]int
+		want  []int
+	}{
+		{"empty", map[int][]int{}, nil},
+		{"chain", map[int][]int{3: {2}, 2: {1}}, nil},
+		{"fan in and out", map[int][]int{2: {1}, 3: {1}, 4: {2, 3}}, nil},
+		{"self", map[int][]int{1: {1}}, []int{1, 1}},
+		{"loop", map[int][]int{1: {2}, 2: {3}, 3: {1}}, []int{1, 2, 3, 1}},
+		{"loop off a chain", map[int][]int{1: {2}, 2: {3}, 3: {4}, 4: {2}}, []int{2, 3, 4, 2}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := findCycle(tt.graph); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("findCycle = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// openWithJobs opens a fresh database holding n jobs with IDs 1 to n
+func openWithJobs(t *testing.T, n int) *sql.DB {
+	t.Helper()
+	db, err := Open(filepath.Join(t.TempDir(), "ant.db3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	for i := 0; i < n; i++ {
+		if _, err := db.Exec("INSERT INTO jobs (schedule, command) VALUES ('@manual', 'true')"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return db
+}
+
+func TestAddDeps(t *testing.T) {
+	db := openWithJobs(t, 3)
+
+	if err := AddDeps(db, 2, []int{1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := AddDeps(db, 3, []int{1, 2}); err != nil {
+		t.Fatal(err)
+	}
+
+	err := AddDeps(db, 1, []int{3})
+	if err == nil || !strings.Contains(err.Error(), "cycle: 1 -> 3 -> 1") {
+		t.Errorf("AddDeps closing a cycle: err = %v", err)
+	}
+	if err := AddDeps(db, 3, []int{9}); err == nil {
+		t.Error("AddDeps on a missing job succeeded")
+	}
+
+	graph, err := Deps(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[int][]int{2: {1}, 3: {1, 2}}; !reflect.DeepEqual(graph, want) {
+		t.Errorf("Deps = %v, want %v", graph, want)
+	}
+}
+
+func TestSatisfyDeps(t *testing.T) {
+	// 3 needs both 1 and 2; 4 needs either
+	db := openWithJobs(t, 4)
+	if err := AddDeps(db, 3, []int{1, 2}); err != nil {
+		t.Fatal(err)
+	}
+	if err := AddDeps(db, 4, []int{1, 2}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("UPDATE jobs SET deps_mode = ? WHERE id = 4", DepsAny); err != nil {
+		t.Fatal(err)
+	}
+
+	steps := []struct {
+		succeeded int
+		want      []int
+	}{
+		{1, []int{4}},
+		{1, []int{4}},
+		{2, []int{3, 4}},
+		{2, []int{4}},
+		{1, []int{3, 4}},
+		{3, nil},
+	}
+	for i, step := range steps {
+		got, err := SatisfyDeps(db, step.succeeded)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, step.want) {
+			t.Errorf("step %d: SatisfyDeps(%d) = %v, want %v", i, step.succeeded, got, step.want)
+		}
+	}
+}
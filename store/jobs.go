@@ -0,0 +1,452 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gagehenrich/ant/runner"
+)
+
+// JobOptions holds the per-job settings given when adding a job
+type JobOptions struct {
+	Retry     runner.RetryPolicy
+	Timeout   time.Duration // 0 for no limit
+	KillGrace time.Duration // wait between SIGTERM and SIGKILL on timeout
+
+	Overlap     runner.Overlap // what to do when a run comes due during another
+	MaxParallel int            // runs allowed at once under runner.Allow
+
+	Pool     string // concurrency pool to join, limited with antd --pool
+	Priority int    // higher goes first when runs wait for a slot
+
+	After    []int // jobs whose success triggers this one
+	AfterAny bool  // trigger on any one of them rather than all
+
+	Limits runner.Limits // cgroup resource limits, applied by antd
+
+	User  string // user to run as, empty for whoever adds the job
+	Group string // group to run as, empty for the user's primary group
+	Cwd   string // working directory, empty for the database's directory
+	Umask int    // -1 to inherit antd's
+
+	Env      []string // KEY=VALUE pairs
+	EnvFiles []string // .env files, read at each run
+	ClearEnv bool     // start from an empty environment rather than antd's
+
+	LogKeep int    // logs of finished runs to keep, 0 for antd's default
+	Output  string // how stdout and stderr are captured: combined, separate or tagged
+}
+
+// Validate checks the options for values that make no sense
+func (o JobOptions) Validate() error {
+	if err := o.Retry.Validate(); err != nil {
+		return err
+	}
+	if o.Timeout < 0 {
+		return fmt.Errorf("timeout cannot be negative")
+	}
+	if o.KillGrace < 0 {
+		return fmt.Errorf("kill grace cannot be negative")
+	}
+	if o.MaxParallel < 1 {
+		return fmt.Errorf("max parallel must be at least 1")
+	}
+	if o.MaxParallel > 1 && o.Overlap != runner.Allow {
+		return fmt.Errorf("max parallel needs the allow overlap policy")
+	}
+	if o.AfterAny && len(o.After) == 0 {
+		return fmt.Errorf("after-any needs a list of jobs")
+	}
+	if o.LogKeep < 0 {
+		return fmt.Errorf("log keep cannot be negative")
+	}
+	if o.Umask > 0777 {
+		return fmt.Errorf("umask must be between 000 and 777")
+	}
+	for _, pair := range o.Env {
+		if _, _, err := runner.ParseEnvVar(pair); err != nil {
+			return err
+		}
+		if strings.Contains(pair, "\n") {
+			return fmt.Errorf("environment values cannot span lines; use an env file")
+		}
+	}
+	return o.Limits.Validate()
+}
+
+// Submitter is the user who adds a job. antd runs the job as them unless
+// the job names another user their run-as rules allow.
+type Submitter struct {
+	Name string
+	UID  int
+}
+
+// AddJob inserts a new job and its dependencies into the database and
+// returns its ID. A zero nextRun is stored as 0, which the daemon treats as
+// not scheduled.
+func AddJob(db *sql.DB, schedule, command string, nextRun time.Time, opts JobOptions, by Submitter) (int64, error) {
+	columns, values := jobSettings(schedule, command, nextRun, opts, by)
+	columns = append(columns, "last_run", "pid")
+	values = append(values, 0, 0) // not run yet
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(
+		fmt.Sprintf("INSERT INTO jobs (%s) VALUES (?%s)",
+			strings.Join(columns, ", "), strings.Repeat(", ?", len(columns)-1)),
+		values...,
+	)
+	if err != nil {
+		return 0, err
+	}
+	jobID, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	if len(opts.After) > 0 {
+		if err := AddDeps(tx, int(jobID), opts.After); err != nil {
+			return 0, err
+		}
+	}
+	return jobID, tx.Commit()
+}
+
+// UpdateJob replaces a job's schedule, command, options and dependencies,
+// as AddJob would have set them. by becomes the job's submitter, since it
+// is now their command that runs. Runs already going carry on as they were.
+func UpdateJob(db *sql.DB, jobID int, schedule, command string, nextRun time.Time, opts JobOptions, by Submitter) error {
+	columns, values := jobSettings(schedule, command, nextRun, opts, by)
+	for i := range columns {
+		columns[i] += " = ?"
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(
+		fmt.Sprintf("UPDATE jobs SET %s WHERE id = ?", strings.Join(columns, ", ")),
+		append(values, jobID)...,
+	)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return fmt.Errorf("job %d not found", jobID)
+	}
+
+	if _, err := tx.Exec("DELETE FROM job_deps WHERE job_id = ?", jobID); err != nil {
+		return err
+	}
+	if len(opts.After) > 0 {
+		if err := AddDeps(tx, jobID, opts.After); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// jobSettings returns the jobs columns that AddJob and UpdateJob set, and
+// their values
+func jobSettings(schedule, command string, nextRun time.Time, opts JobOptions, by Submitter) ([]string, []any) {
+	var nextRunUnix int64
+	if !nextRun.IsZero() {
+		nextRunUnix = nextRun.Unix()
+	}
+
+	depsMode := DepsAll
+	if opts.AfterAny {
+		depsMode = DepsAny
+	}
+	envMode := runner.EnvInherit
+	if opts.ClearEnv {
+		envMode = runner.EnvClear
+	}
+
+	settings := []struct {
+		column string
+		value  any
+	}{
+		{"schedule", schedule},
+		{"command", command},
+		{"next_run", nextRunUnix},
+		{"retry_max_attempts", opts.Retry.MaxAttempts},
+		{"retry_delay_ms", opts.Retry.Delay.Milliseconds()},
+		{"retry_backoff", opts.Retry.Backoff},
+		{"retry_jitter", opts.Retry.Jitter},
+		{"retry_exit_codes", runner.FormatExitCodes(opts.Retry.ExitCodes)},
+		{"timeout_ms", opts.Timeout.Milliseconds()},
+		{"kill_grace_ms", opts.KillGrace.Milliseconds()},
+		{"overlap", opts.Overlap.String()},
+		{"max_parallel", opts.MaxParallel},
+		{"pool", opts.Pool},
+		{"priority", opts.Priority},
+		{"deps_mode", depsMode},
+		{"cpu_weight", opts.Limits.CPUWeight},
+		{"cpu_quota", opts.Limits.CPUQuota},
+		{"memory_max", opts.Limits.MemoryMax},
+		{"pids_max", opts.Limits.PidsMax},
+		{"io_weight", opts.Limits.IOWeight},
+		{"run_user", opts.User},
+		{"run_group", opts.Group},
+		{"cwd", opts.Cwd},
+		{"umask", opts.Umask},
+		{"submitted_by", by.Name},
+		{"submitted_uid", by.UID},
+		{"env", strings.Join(opts.Env, "\n")},
+		{"env_files", strings.Join(opts.EnvFiles, "\n")},
+		{"env_mode", envMode},
+		{"log_keep", opts.LogKeep},
+		{"output", opts.Output},
+	}
+	columns := make([]string, len(settings))
+	values := make([]any, len(settings))
+	for i, s := range settings {
+		columns[i], values[i] = s.column, s.value
+	}
+	return columns, values
+}
+
+// SetPaused pauses or resumes a job. A paused job starts no runs: its
+// schedule, retries and queued runs wait until it is resumed, and then
+// runs it missed meanwhile are handled by its misfire policy.
+func SetPaused(db *sql.DB, jobID int, paused bool) error {
+	result, err := db.Exec("UPDATE jobs SET paused = ? WHERE id = ?", paused, jobID)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return fmt.Errorf("job %d not found", jobID)
+	}
+	return nil
+}
+
+// DeleteJob removes a job and its dependencies from the database in one
+// transaction. Its queued runs are cancelled and runs still marked running
+// are recorded as killed. Callers stop the job's runs first; each leads its
+// own process group, listed by RunningGroups.
+func DeleteJob(db *sql.DB, jobID int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("DELETE FROM jobs WHERE id = ?", jobID)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return fmt.Errorf("job %d not found", jobID)
+	}
+
+	// Whoever started a run records how it ended once it sees it go, if
+	// it is still there to
+	now := time.Now().Unix()
+	_, err = tx.Exec(
+		"UPDATE job_runs SET status = 'killed', end_time = ? WHERE job_id = ? AND status = 'running'",
+		now, jobID,
+	)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(
+		"UPDATE job_runs SET status = 'killed', end_time = ?, note = 'cancelled: job deleted' WHERE job_id = ? AND status = 'queued'",
+		now, jobID,
+	)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("DELETE FROM job_deps WHERE job_id = ? OR depends_on = ?", jobID, jobID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// RunningGroups returns the process groups of a job's unfinished runs: the
+// one in jobs.pid plus any others antd is running side by side
+func RunningGroups(db *sql.DB, jobID int) ([]int, error) {
+	var pid int
+	if err := db.QueryRow("SELECT COALESCE(pid, 0) FROM jobs WHERE id = ?", jobID).Scan(&pid); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("job %d not found", jobID)
+		}
+		return nil, err
+	}
+
+	rows, err := db.Query(
+		"SELECT DISTINCT pid FROM job_runs WHERE job_id = ? AND status = 'running' AND pid > 0",
+		jobID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var groups []int
+	if pid > 0 {
+		groups = append(groups, pid)
+	}
+	for rows.Next() {
+		var runPID int
+		if err := rows.Scan(&runPID); err != nil {
+			return nil, err
+		}
+		if runPID != pid {
+			groups = append(groups, runPID)
+		}
+	}
+	return groups, rows.Err()
+}
+
+// JobStatus is a job as ant :jobs: shows it. Times are Unix timestamps.
+type JobStatus struct {
+	ID           int    `json:"id"`
+	Schedule     string `json:"schedule"` // empty for a watch loop
+	Command      string `json:"command"`
+	PID          int    `json:"pid"`      // process group of the newest running run, 0 if none
+	NextRun      int64  `json:"next_run"` // 0 if not scheduled
+	LastRun      int64  `json:"last_run"` // 0 if never run
+	LastExitCode *int   `json:"last_exit_code"`
+	LastStatus   string `json:"last_status"` // ok, failed, killed, timeout, running or empty if never run
+	FailCount    int    `json:"fail_count"`  // consecutive unsuccessful runs
+	RetryAt      int64  `json:"retry_at"`    // 0 if no retry is pending
+	RetryAttempt int    `json:"retry_attempt"`
+	Queued       bool   `json:"queued"` // a run is waiting to start
+	Paused       bool   `json:"paused"`
+	After        []int  `json:"after"` // jobs it runs after
+	DepsMode     string `json:"deps_mode"`
+	SubmittedUID int    `json:"-"` // user who added the job, -1 if not recorded
+}
+
+// ListJobs returns every job in ID order
+func ListJobs(db *sql.DB) ([]JobStatus, error) {
+	graph, err := Deps(db)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(`
+		SELECT id, schedule, command, pid, next_run, last_run,
+			last_exit_code, last_status, fail_count, retry_at, retry_attempt,
+			EXISTS (SELECT 1 FROM job_runs WHERE job_id = jobs.id AND status = 'queued'),
+			paused, deps_mode, submitted_uid
+		FROM jobs ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	jobs := []JobStatus{}
+	for rows.Next() {
+		var job JobStatus
+		var lastExitCode sql.NullInt64
+		var pid sql.NullInt64
+		err := rows.Scan(&job.ID, &job.Schedule, &job.Command, &pid, &job.NextRun, &job.LastRun,
+			&lastExitCode, &job.LastStatus, &job.FailCount, &job.RetryAt, &job.RetryAttempt, &job.Queued,
+			&job.Paused, &job.DepsMode, &job.SubmittedUID)
+		if err != nil {
+			return nil, err
+		}
+		job.PID = int(pid.Int64)
+		if lastExitCode.Valid {
+			code := int(lastExitCode.Int64)
+			job.LastExitCode = &code
+		}
+		job.After = graph[job.ID]
+		if job.After == nil {
+			job.After = []int{}
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
+
+// RunRecord is one run of a job as ant :history: shows it. Times are Unix
+// timestamps, 0 where the run never got that far.
+type RunRecord struct {
+	ID         int64  `json:"id"`
+	JobID      int    `json:"job_id"`
+	Scheduled  int64  `json:"scheduled_time"`
+	Attempt    int    `json:"attempt"`
+	Started    int64  `json:"start_time"`
+	Ended      int64  `json:"end_time"`
+	DurationMs *int64 `json:"duration_ms"`
+	CPUUsec    *int64 `json:"cpu_usec"`          // nil if not measured
+	PeakMemory *int64 `json:"peak_memory_bytes"` // nil if not measured
+	ExitCode   *int   `json:"exit_code"`
+	Signal     int    `json:"signal"` // 0 unless killed by a signal
+	PID        int    `json:"pid"`
+	Host       string `json:"host"`
+	Status     string `json:"status"` // running, queued, ok, failed, killed, timeout, replaced or skipped
+	Note       string `json:"note"`
+	Output     string `json:"output"` // how its stdout and stderr were captured
+}
+
+// History returns the most recent runs of a job, newest first
+func History(db *sql.DB, jobID, limit int) ([]RunRecord, error) {
+	rows, err := db.Query(`
+		SELECT id, job_id, scheduled_time, attempt, start_time, end_time, duration_ms,
+			cpu_usec, peak_memory_bytes, exit_code, signal, pid, host, status, note, output
+		FROM job_runs
+		WHERE job_id = ?
+		ORDER BY id DESC
+		LIMIT ?`,
+		jobID, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	runs := []RunRecord{}
+	for rows.Next() {
+		var (
+			run                             RunRecord
+			scheduled, started, ended       sql.NullInt64
+			durationMs, cpuUsec, peakMemory sql.NullInt64
+			exitCode, signal, pid           sql.NullInt64
+			host, status, note              sql.NullString
+		)
+		err := rows.Scan(&run.ID, &run.JobID, &scheduled, &run.Attempt, &started, &ended, &durationMs,
+			&cpuUsec, &peakMemory, &exitCode, &signal, &pid, &host, &status, &note, &run.Output)
+		if err != nil {
+			return nil, err
+		}
+		run.Scheduled, run.Started, run.Ended = scheduled.Int64, started.Int64, ended.Int64
+		run.DurationMs = nullInt64(durationMs)
+		run.CPUUsec = nullInt64(cpuUsec)
+		run.PeakMemory = nullInt64(peakMemory)
+		if exitCode.Valid {
+			code := int(exitCode.Int64)
+			run.ExitCode = &code
+		}
+		run.Signal, run.PID = int(signal.Int64), int(pid.Int64)
+		run.Host, run.Status, run.Note = host.String, status.String, note.String
+		runs = append(runs, run)
+	}
+	return runs, rows.Err()
+}
+
+func nullInt64(n sql.NullInt64) *int64 {
+	if !n.Valid {
+		return nil
+	}
+	return &n.Int64
+}
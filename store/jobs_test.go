@@ -0,0 +1,182 @@
+package store
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gagehenrich/ant/runner"
+)
+
+func TestAddJob(t *testing.T) {
+	db := openWithJobs(t, 0)
+	if _, err := AddJob(db, "@manual", "true", time.Time{}, JobOptions{MaxParallel: 1}, Submitter{}); err != nil {
+		t.Fatal(err)
+	}
+	opts := JobOptions{
+		Retry:       runner.RetryPolicy{MaxAttempts: 3, Delay: time.Second, Backoff: 2},
+		KillGrace:   runner.DefaultKillGrace,
+		MaxParallel: 1,
+		After:       []int{1},
+		Umask:       -1,
+		Env:         []string{"A=1", "B=2"},
+		Output:      "tagged",
+	}
+	next := time.Unix(1_800_000_000, 0)
+	id, err := AddJob(db, "@hourly", "echo hi", next, opts, Submitter{Name: "alice", UID: 1000})
+	if err != nil {
+		t.Fatalf("AddJob unexpected error: %v", err)
+	}
+
+	var submitter, env, output string
+	var uid, attempts int
+	err = db.QueryRow("SELECT submitted_by, submitted_uid, env, output, retry_max_attempts FROM jobs WHERE id = ?", id).
+		Scan(&submitter, &uid, &env, &output, &attempts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if submitter != "alice" || uid != 1000 || env != "A=1\nB=2" || output != "tagged" || attempts != 3 {
+		t.Errorf("stored %q, %d, %q, %q, %d", submitter, uid, env, output, attempts)
+	}
+
+	jobs, err := ListJobs(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 2 {
+		t.Fatalf("ListJobs returned %d jobs, want 2", len(jobs))
+	}
+	got := jobs[1]
+	if got.ID != int(id) || got.Command != "echo hi" || got.NextRun != next.Unix() ||
+		!reflect.DeepEqual(got.After, []int{1}) || got.DepsMode != DepsAll || got.LastExitCode != nil {
+		t.Errorf("ListJobs = %+v", got)
+	}
+
+	// A dependency that doesn't exist leaves no job behind
+	opts.After = []int{42}
+	if _, err := AddJob(db, "@hourly", "echo hi", next, opts, Submitter{}); err == nil {
+		t.Error("AddJob with a missing dependency succeeded")
+	}
+	if jobs, _ := ListJobs(db); len(jobs) != 2 {
+		t.Errorf("failed AddJob left %d jobs, want 2", len(jobs))
+	}
+}
+
+func TestHistoryAndDelete(t *testing.T) {
+	db := openWithJobs(t, 2)
+	for _, stmt := range []string{
+		`INSERT INTO job_runs (job_id, scheduled_time, start_time, end_time, duration_ms, exit_code, status)
+			VALUES (1, 100, 100, 102, 2000, 0, 'ok')`,
+		`INSERT INTO job_runs (job_id, scheduled_time, status, note) VALUES (1, 200, 'skipped', 'previous run still running')`,
+		`INSERT INTO job_runs (job_id, scheduled_time, status) VALUES (2, 300, 'queued')`,
+		`INSERT INTO job_runs (job_id, scheduled_time, status) VALUES (1, 400, 'queued')`,
+		`INSERT INTO job_deps (job_id, depends_on) VALUES (2, 1)`,
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	runs, err := History(db, 1, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 3 || runs[0].Status != "queued" || runs[1].Status != "skipped" || runs[2].Status != "ok" {
+		t.Fatalf("History = %+v, want the queued, skipped and ok runs", runs)
+	}
+	runs = runs[1:]
+	if runs[0].ExitCode != nil || runs[0].Started != 0 || runs[0].Note != "previous run still running" {
+		t.Errorf("skipped run = %+v", runs[0])
+	}
+	if runs[1].ExitCode == nil || *runs[1].ExitCode != 0 || runs[1].DurationMs == nil || *runs[1].DurationMs != 2000 {
+		t.Errorf("ok run = %+v", runs[1])
+	}
+	if runs, _ := History(db, 1, 1); len(runs) != 1 {
+		t.Errorf("History with limit 1 returned %d runs", len(runs))
+	}
+
+	if err := DeleteJob(db, 1); err != nil {
+		t.Fatalf("DeleteJob unexpected error: %v", err)
+	}
+	if err := DeleteJob(db, 1); err == nil {
+		t.Error("deleting a deleted job succeeded")
+	}
+	var queued int
+	if err := db.QueryRow("SELECT COUNT(*) FROM job_runs WHERE status = 'queued'").Scan(&queued); err != nil {
+		t.Fatal(err)
+	}
+	if queued != 1 {
+		t.Errorf("%d queued runs left, want only job 2's", queued)
+	}
+	graph, err := Deps(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(graph) != 0 {
+		t.Errorf("DeleteJob left dependencies %v", graph)
+	}
+}
+
+func TestUpdateAndPause(t *testing.T) {
+	db := openWithJobs(t, 0)
+	base := JobOptions{MaxParallel: 1, Umask: -1, Output: "combined"}
+	for i := 0; i < 2; i++ {
+		if _, err := AddJob(db, "@manual", "true", time.Time{}, base, Submitter{Name: "alice", UID: 1000}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	opts := base
+	opts.After = []int{1}
+	if _, err := AddJob(db, "@hourly", "echo hi", time.Unix(100, 0), opts, Submitter{Name: "alice", UID: 1000}); err != nil {
+		t.Fatal(err)
+	}
+
+	opts.After = []int{2}
+	opts.Env = []string{"A=1"}
+	if err := UpdateJob(db, 3, "@daily", "echo bye", time.Unix(200, 0), opts, Submitter{Name: "bob", UID: 1001}); err != nil {
+		t.Fatalf("UpdateJob unexpected error: %v", err)
+	}
+	jobs, err := ListJobs(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := jobs[2]
+	if got.Schedule != "@daily" || got.Command != "echo bye" || got.NextRun != 200 || !reflect.DeepEqual(got.After, []int{2}) {
+		t.Errorf("updated job = %+v", got)
+	}
+	var submitter, env string
+	if err := db.QueryRow("SELECT submitted_by, env FROM jobs WHERE id = 3").Scan(&submitter, &env); err != nil {
+		t.Fatal(err)
+	}
+	if submitter != "bob" || env != "A=1" {
+		t.Errorf("updated submitter, env = %q, %q", submitter, env)
+	}
+
+	// A cycle is refused and changes nothing
+	opts.After = []int{3}
+	if err := UpdateJob(db, 2, "@manual", "false", time.Time{}, opts, Submitter{}); err == nil {
+		t.Error("UpdateJob closing a cycle succeeded")
+	}
+	if jobs, _ := ListJobs(db); jobs[1].Command != "true" {
+		t.Errorf("failed UpdateJob changed the command to %q", jobs[1].Command)
+	}
+	if err := UpdateJob(db, 42, "@manual", "true", time.Time{}, base, Submitter{}); err == nil {
+		t.Error("updating a missing job succeeded")
+	}
+
+	if err := SetPaused(db, 3, true); err != nil {
+		t.Fatalf("SetPaused unexpected error: %v", err)
+	}
+	if jobs, _ := ListJobs(db); !jobs[2].Paused {
+		t.Error("paused job not listed as paused")
+	}
+	if err := SetPaused(db, 3, false); err != nil {
+		t.Fatal(err)
+	}
+	if jobs, _ := ListJobs(db); jobs[2].Paused {
+		t.Error("resumed job still listed as paused")
+	}
+	if err := SetPaused(db, 42, true); err == nil {
+		t.Error("pausing a missing job succeeded")
+	}
+}
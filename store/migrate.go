@@ -0,0 +1,171 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// migrations are the schema changes in the order they were made. The
+// database's PRAGMA user_version records how many have been applied, so
+// entries must only ever be appended, never edited or reordered.
+var migrations = []string{
+	// 1: the jobs table as ant has always created it, plus run history.
+	// IF NOT EXISTS lets databases from before versioning adopt it.
+	`CREATE TABLE IF NOT EXISTS jobs (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		schedule TEXT,
+		command TEXT,
+		pid INTEGER,
+		next_run INTEGER, -- Unix timestamp
+		last_run INTEGER  -- Unix timestamp
+	);
+	CREATE TABLE IF NOT EXISTS job_runs (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		job_id INTEGER NOT NULL,
+		scheduled_time INTEGER, -- Unix timestamp
+		start_time INTEGER,     -- Unix timestamp
+		end_time INTEGER,       -- Unix timestamp
+		duration_ms INTEGER,
+		exit_code INTEGER,
+		signal INTEGER,
+		pid INTEGER,
+		host TEXT,
+		status TEXT,            -- running, ok, failed, killed or skipped
+		note TEXT
+	);
+	CREATE INDEX IF NOT EXISTS job_runs_job_id ON job_runs (job_id, start_time);`,
+
+	// 2: outcome of each job's latest run
+	`ALTER TABLE jobs ADD COLUMN last_exit_code INTEGER;
+	ALTER TABLE jobs ADD COLUMN last_status TEXT NOT NULL DEFAULT ''; -- ok, failed, killed, timeout or running
+	ALTER TABLE jobs ADD COLUMN fail_count INTEGER NOT NULL DEFAULT 0; -- consecutive unsuccessful runs`,
+
+	// 3: retry policy, the pending retry if any, and attempt numbers in history
+	`ALTER TABLE jobs ADD COLUMN retry_max_attempts INTEGER NOT NULL DEFAULT 1;
+	ALTER TABLE jobs ADD COLUMN retry_delay_ms INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE jobs ADD COLUMN retry_backoff REAL NOT NULL DEFAULT 2;
+	ALTER TABLE jobs ADD COLUMN retry_jitter REAL NOT NULL DEFAULT 0;
+	ALTER TABLE jobs ADD COLUMN retry_exit_codes TEXT NOT NULL DEFAULT ''; -- comma separated, empty for any
+	ALTER TABLE jobs ADD COLUMN retry_at INTEGER NOT NULL DEFAULT 0;        -- Unix timestamp, 0 if none pending
+	ALTER TABLE jobs ADD COLUMN retry_attempt INTEGER NOT NULL DEFAULT 0;   -- attempt number of the pending retry
+	ALTER TABLE jobs ADD COLUMN retry_scheduled INTEGER NOT NULL DEFAULT 0; -- scheduled time of the run being retried
+	ALTER TABLE job_runs ADD COLUMN attempt INTEGER NOT NULL DEFAULT 1;`,
+
+	// 4: run time limit; runs that hit it get the status timeout
+	`ALTER TABLE jobs ADD COLUMN timeout_ms INTEGER NOT NULL DEFAULT 0; -- 0 for no limit
+	ALTER TABLE jobs ADD COLUMN kill_grace_ms INTEGER NOT NULL DEFAULT 10000;`,
+
+	// 5: what to do when a run comes due while the last one is still going.
+	// Runs can now also be queued or replaced.
+	`ALTER TABLE jobs ADD COLUMN overlap TEXT NOT NULL DEFAULT 'forbid'; -- forbid, queue, replace or allow
+	ALTER TABLE jobs ADD COLUMN max_parallel INTEGER NOT NULL DEFAULT 1;  -- runs at once under allow
+	CREATE INDEX job_runs_status ON job_runs (status, job_id);`,
+
+	// 6: concurrency pool membership and priority for runs waiting for a slot
+	`ALTER TABLE jobs ADD COLUMN pool TEXT NOT NULL DEFAULT '';
+	ALTER TABLE jobs ADD COLUMN priority INTEGER NOT NULL DEFAULT 0; -- higher goes first`,
+
+	// 7: jobs that run after other jobs succeed
+	`CREATE TABLE job_deps (
+		job_id INTEGER NOT NULL,              -- the dependent job
+		depends_on INTEGER NOT NULL,          -- the job it runs after
+		satisfied INTEGER NOT NULL DEFAULT 0, -- succeeded since the dependent was last triggered
+		PRIMARY KEY (job_id, depends_on)
+	);
+	CREATE INDEX job_deps_depends_on ON job_deps (depends_on);
+	ALTER TABLE jobs ADD COLUMN deps_mode TEXT NOT NULL DEFAULT 'all'; -- all or any`,
+
+	// 8: cgroup resource limits, 0 for none, and what each run consumed
+	`ALTER TABLE jobs ADD COLUMN cpu_weight INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE jobs ADD COLUMN cpu_quota INTEGER NOT NULL DEFAULT 0;  -- percent of one CPU
+	ALTER TABLE jobs ADD COLUMN memory_max INTEGER NOT NULL DEFAULT 0; -- bytes
+	ALTER TABLE jobs ADD COLUMN pids_max INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE jobs ADD COLUMN io_weight INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE job_runs ADD COLUMN peak_memory_bytes INTEGER; -- NULL if not measured
+	ALTER TABLE job_runs ADD COLUMN cpu_usec INTEGER;`,
+
+	// 9: who runs a job and where, and who added it. Jobs from before this
+	// have no recorded submitter and run as antd's own user.
+	`ALTER TABLE jobs ADD COLUMN run_user TEXT NOT NULL DEFAULT '';  -- empty for the submitter
+	ALTER TABLE jobs ADD COLUMN run_group TEXT NOT NULL DEFAULT ''; -- empty for the user's primary group
+	ALTER TABLE jobs ADD COLUMN cwd TEXT NOT NULL DEFAULT '';       -- empty for the database's directory
+	ALTER TABLE jobs ADD COLUMN umask INTEGER NOT NULL DEFAULT -1;  -- -1 to inherit antd's
+	ALTER TABLE jobs ADD COLUMN submitted_by TEXT NOT NULL DEFAULT '';
+	ALTER TABLE jobs ADD COLUMN submitted_uid INTEGER NOT NULL DEFAULT -1;`,
+
+	// 10: the environment a job runs with
+	`ALTER TABLE jobs ADD COLUMN env TEXT NOT NULL DEFAULT '';       -- KEY=VALUE lines
+	ALTER TABLE jobs ADD COLUMN env_files TEXT NOT NULL DEFAULT ''; -- one path per line, read at each run
+	ALTER TABLE jobs ADD COLUMN env_mode TEXT NOT NULL DEFAULT 'inherit'; -- inherit or clear`,
+
+	// 11: how many runs' logs to keep, overriding antd's --log-keep
+	`ALTER TABLE jobs ADD COLUMN log_keep INTEGER NOT NULL DEFAULT 0; -- 0 for antd's default`,
+
+	// 12: how a job's stdout and stderr are captured, and how each run's were
+	`ALTER TABLE jobs ADD COLUMN output TEXT NOT NULL DEFAULT 'combined'; -- combined, separate or tagged
+	ALTER TABLE job_runs ADD COLUMN output TEXT NOT NULL DEFAULT 'combined';`,
+
+	// 13: jobs paused through the API, which start no runs until resumed
+	`ALTER TABLE jobs ADD COLUMN paused INTEGER NOT NULL DEFAULT 0;`,
+}
+
+// SchemaVersion is the schema version this build understands
+func SchemaVersion() int {
+	return len(migrations)
+}
+
+// Version returns the schema version recorded in the database
+func Version(db *sql.DB) (int, error) {
+	var version int
+	err := db.QueryRow("PRAGMA user_version").Scan(&version)
+	return version, err
+}
+
+// Migrate applies any pending migrations, each in its own transaction. It
+// refuses to touch a database whose schema is newer than this build.
+func Migrate(db *sql.DB) error {
+	version, err := Version(db)
+	if err != nil {
+		return fmt.Errorf("failed to read schema version: %v", err)
+	}
+
+	if version > len(migrations) {
+		return fmt.Errorf("database schema version %d is newer than this build supports (%d); upgrade ant",
+			version, len(migrations))
+	}
+
+	for version < len(migrations) {
+		if err := applyMigration(db, version+1, migrations[version]); err != nil {
+			return fmt.Errorf("migration %d failed: %v", version+1, err)
+		}
+		version++
+	}
+	return nil
+}
+
+// applyMigration runs one migration and records its version atomically
+func applyMigration(db *sql.DB, version int, stmt string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Another process may have migrated since the version was read
+	var current int
+	if err := tx.QueryRow("PRAGMA user_version").Scan(&current); err != nil {
+		return err
+	}
+	if current >= version {
+		return nil
+	}
+
+	if _, err := tx.Exec(stmt); err != nil {
+		return err
+	}
+	// PRAGMA does not take bind parameters
+	if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", version)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
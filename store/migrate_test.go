@@ -0,0 +1,123 @@
+package store
+
+import (
+	"database/sql"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func tableExists(t *testing.T, db *sql.DB, name string) bool {
+	t.Helper()
+	var n int
+	err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?", name).Scan(&n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n == 1
+}
+
+func TestOpenFresh(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "ant.db3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	version, err := Version(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != SchemaVersion() {
+		t.Errorf("version = %d, want %d", version, SchemaVersion())
+	}
+	for _, table := range []string{"jobs", "job_runs", "job_deps"} {
+		if !tableExists(t, db, table) {
+			t.Errorf("table %s missing", table)
+		}
+	}
+
+	// Running again is a no-op
+	if err := Migrate(db); err != nil {
+		t.Errorf("second Migrate: %v", err)
+	}
+}
+
+func TestOpenLegacy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ant.db3")
+
+	// A database created by ant before schema versioning
+	legacy, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = legacy.Exec(`
+		CREATE TABLE jobs (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			schedule TEXT, command TEXT, pid INTEGER, next_run INTEGER, last_run INTEGER
+		);
+		INSERT INTO jobs (schedule, command, pid, next_run, last_run) VALUES ('e 1h', 'true', 0, 1, 0);`)
+	legacy.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var n int
+	if err := db.QueryRow("SELECT COUNT(*) FROM jobs").Scan(&n); err != nil || n != 1 {
+		t.Errorf("existing job lost: count %d, err %v", n, err)
+	}
+	if !tableExists(t, db, "job_runs") {
+		t.Error("table job_runs missing")
+	}
+}
+
+func TestOpenNewerSchema(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ant.db3")
+	db, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("PRAGMA user_version = 999"); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	if _, err := Open(path); err == nil || !strings.Contains(err.Error(), "newer") {
+		t.Errorf("Open on newer schema: err = %v, want newer schema error", err)
+	}
+}
+
+func TestMigrateRollsBack(t *testing.T) {
+	saved := migrations
+	defer func() { migrations = saved }()
+	migrations = append(append([]string{}, saved...),
+		"CREATE TABLE partial (id INTEGER); INSERT INTO no_such_table VALUES (1);")
+
+	path := filepath.Join(t.TempDir(), "ant.db3")
+	if _, err := Open(path); err == nil {
+		t.Fatal("Open succeeded with a broken migration")
+	}
+
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	version, err := Version(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != len(saved) {
+		t.Errorf("version = %d, want %d", version, len(saved))
+	}
+	if tableExists(t, db, "partial") {
+		t.Error("failed migration was not rolled back")
+	}
+}
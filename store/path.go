@@ -0,0 +1,45 @@
+package store
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+const (
+	// SystemDir holds the database when ant runs system-wide
+	SystemDir = "/var/lib/antd"
+
+	// FileName is the database file name inside its directory
+	FileName = "ant.db3"
+)
+
+// Path resolves the database location shared by ant and antd. In order:
+// an explicit path (the --db flag), the ANT_DB environment variable,
+// SystemDir in system mode, and otherwise the user's XDG data directory.
+// The result is always absolute so jobs can use it as a working directory.
+func Path(explicit string, system bool) (string, error) {
+	path := explicit
+	if path == "" {
+		path = os.Getenv("ANT_DB")
+	}
+
+	if path == "" && system {
+		path = filepath.Join(SystemDir, FileName)
+	}
+
+	if path == "" {
+		dataHome := os.Getenv("XDG_DATA_HOME")
+		// The XDG spec says relative paths are invalid and must be ignored
+		if dataHome == "" || !filepath.IsAbs(dataHome) {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return "", fmt.Errorf("cannot locate data directory: %v", err)
+			}
+			dataHome = filepath.Join(home, ".local", "share")
+		}
+		path = filepath.Join(dataHome, "ant", FileName)
+	}
+
+	return filepath.Abs(path)
+}
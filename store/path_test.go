@@ -0,0 +1,76 @@
+package store
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestPath(t *testing.T) {
+	cwd, err := filepath.Abs(".")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		explicit string
+		system   bool
+		env      map[string]string
+		want     string
+	}{
+		{
+			name:     "flag wins",
+			explicit: "/tmp/flag.db3",
+			system:   true,
+			env:      map[string]string{"ANT_DB": "/tmp/env.db3"},
+			want:     "/tmp/flag.db3",
+		},
+		{
+			name:     "relative flag is made absolute",
+			explicit: "ant.db3",
+			want:     filepath.Join(cwd, "ant.db3"),
+		},
+		{
+			name:   "env over system mode",
+			system: true,
+			env:    map[string]string{"ANT_DB": "/tmp/env.db3"},
+			want:   "/tmp/env.db3",
+		},
+		{
+			name:   "system mode",
+			system: true,
+			env:    map[string]string{"XDG_DATA_HOME": "/tmp/xdg"},
+			want:   "/var/lib/antd/ant.db3",
+		},
+		{
+			name: "XDG data home",
+			env:  map[string]string{"XDG_DATA_HOME": "/tmp/xdg", "HOME": "/home/someone"},
+			want: "/tmp/xdg/ant/ant.db3",
+		},
+		{
+			name: "XDG default",
+			env:  map[string]string{"HOME": "/home/someone"},
+			want: "/home/someone/.local/share/ant/ant.db3",
+		},
+		{
+			name: "relative XDG data home is ignored",
+			env:  map[string]string{"XDG_DATA_HOME": "data", "HOME": "/home/someone"},
+			want: "/home/someone/.local/share/ant/ant.db3",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, key := range []string{"ANT_DB", "XDG_DATA_HOME", "HOME"} {
+				t.Setenv(key, tt.env[key])
+			}
+			got, err := Path(tt.explicit, tt.system)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("Path(%q, %v) = %s, want %s", tt.explicit, tt.system, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,34 @@
+// Package store owns the SQLite database shared by ant and antd: opening it,
+// keeping its schema up to date, and the jobs, runs and job dependency
+// graph kept in it.
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// Open opens the database at path, creating its directory if needed, and
+// brings its schema up to date.
+// Transactions take the write lock up front so ant and antd migrating at the
+// same time wait for each other instead of failing.
+func Open(path string) (*sql.DB, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create database directory: %v", err)
+	}
+
+	db, err := sql.Open("sqlite3", path+"?_txlock=immediate&_busy_timeout=5000")
+	if err != nil {
+		return nil, err
+	}
+
+	if err := Migrate(db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to migrate %s: %v", path, err)
+	}
+	return db, nil
+}